@@ -1,34 +1,142 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
+	"maps"
+	"os"
+	"os/signal"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/adaptor/v2"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/pprof"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
 	bootstraplog "go.dfds.cloud/bootstrap/log"
 	"go.dfds.cloud/copilot-premium-usage-exporter/internal"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/api"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/audit"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/billing"
 	"go.dfds.cloud/copilot-premium-usage-exporter/internal/config"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/enrich"
 	"go.dfds.cloud/copilot-premium-usage-exporter/internal/github"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/github/githubtest"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/logctx"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/report"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/rules"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/schedule"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/sink"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/source"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/storage"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/systemd"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/tracing"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/ui"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/webhook"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 var logger *zap.Logger
-var collectMu sync.RWMutex
 
+// version and commit are set at build time with
+// -ldflags "-X main.version=... -X main.commit=...".
+var version, commit string
+
+// registry serves /metrics and feeds the push sinks. It is used instead of
+// the default registry so the runtime collectors are chosen here.
+var registry = prometheus.NewRegistry()
+
+const shutdownTimeout = 10 * time.Second
+
+// webhookSettleDelay lets a burst of webhook deliveries, e.g. a team being
+// granted seats, accumulate into a single partial cycle.
+const webhookSettleDelay = 5 * time.Second
+
+// snapshots holds the usage published by the latest cycle for the JSON API.
+var snapshots snapshot.Store
+
+// responses keeps the raw usage responses served at /debug/github/responses,
+// nil unless admin.captureResponses is set.
+var responses *github.ResponseRing
+
+// overdueAt is when the running cycle counts as wedged, in Unix nanoseconds,
+// or 0 while the worker waits for the next one. The systemd watchdog reads
+// it.
+var overdueAt atomic.Int64
+
+// watchdogGrace is how long past its deadline a cycle may keep publishing and
+// writing sinks before the worker counts as wedged.
+const watchdogGrace = 5 * time.Minute
+
+// notReady maps each tenant whose preflight checks have not passed to why
+// /readyz fails.
+var notReady sync.Map
+
+// lastCycles maps each tenant to the audit summary of its most recent cycle,
+// for the web UI.
+var lastCycles sync.Map
+
+// metricEntry is one usage item with its label values in the order of
+// internal.UsageLabels, shared by the three per-item families so large
+// enterprises do not pay for a label map per series.
 type metricEntry struct {
-	labels         prometheus.Labels
-	grossQuantity  float64
-	grossAmount    float64
-	discountAmount float64
+	labelValues []string
+	item        github.UsageItem
+}
+
+// flagEnv maps each command-line flag to the environment variable it stands
+// in for. Flags are applied to the environment before the configuration is
+// loaded, so they take precedence over it and survive reloads.
+var flagEnv = map[string]string{
+	"config":      "CPUE_CONFIGFILE",
+	"enterprise":  "CPUE_GITHUB_ENTERPRISE",
+	"interval":    "CPUE_WORKERINTERVAL",
+	"listen-addr": "CPUE_LISTENADDR",
+	"log-level":   "CPUE_LOGLEVEL",
 }
 
 func main() {
+	demo := flag.Bool("demo", false, "serve synthetic seats and usage from a built-in fake GitHub API instead of calling GitHub")
+	once := flag.Bool("once", false, "collect a single cycle, print the resulting metrics to stdout and exit")
+	flag.String("config", "", "path of the JSON config file (CPUE_CONFIGFILE)")
+	flag.String("enterprise", "", "enterprise slug to collect (CPUE_GITHUB_ENTERPRISE)")
+	flag.Int("interval", 0, "seconds between collection cycles (CPUE_WORKERINTERVAL)")
+	flag.String("listen-addr", "", "address of the API listener (CPUE_LISTENADDR)")
+	flag.String("log-level", "", "log level (CPUE_LOGLEVEL)")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(out, "\nEach setting is taken from the first of these that sets it: command-line flags,")
+		fmt.Fprintln(out, "CPUE_* environment variables, the config file, built-in defaults.")
+	}
+	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		if env, ok := flagEnv[f.Name]; ok {
+			os.Setenv(env, f.Value.String())
+		}
+	})
+
 	conf, err := config.Load()
 	if err != nil {
 		panic(err)
@@ -38,84 +146,1446 @@ func main() {
 	logger = bootstraplog.Logger
 	defer logger.Sync()
 
-	logger.Info("starting copilot-premium-usage-exporter")
+	version, commit := buildInfo()
+	logger.Info("starting copilot-premium-usage-exporter", zap.String("version", version), zap.String("commit", commit))
+
+	override := func(c *config.Config) {}
+	if *demo {
+		srv := githubtest.NewServer(githubtest.Options{Enterprise: "demo", Seats: 250})
+		defer srv.Close()
+		override = func(c *config.Config) {
+			c.Github.BaseURL = srv.URL
+			c.Github.Enterprise = "demo"
+			c.Github.Token = "demo"
+			for i := range c.Tenants {
+				c.Tenants[i].BaseURL = srv.URL
+				c.Tenants[i].Enterprise = "demo"
+				c.Tenants[i].Token = "demo"
+			}
+		}
+		logger.Info("running in demo mode against fake github api", zap.String("url", srv.URL))
+	}
+	override(&conf)
+
+	if err := conf.Validate(); err != nil {
+		logger.Fatal("invalid configuration", zap.Error(err))
+	}
+	for _, t := range conf.TenantNames() {
+		notReady.Store(t, "waiting for preflight checks")
+	}
+	if len(conf.Tenants) == 0 {
+		notReady.Store("", "waiting for preflight checks")
+	}
+	if conf.Tracing.Enabled {
+		shutdown, err := tracing.Setup(context.Background(), conf.Tracing.Endpoint, conf.Tracing.SampleRatio, version)
+		if err != nil {
+			logger.Fatal("failed to set up tracing", zap.Error(err))
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				logger.Warn("failed to flush traces", zap.Error(err))
+			}
+		}()
+	}
+
+	reg := prometheus.WrapRegistererWith(conf.Metrics.ExtraLabels, registry)
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	err = internal.Register(reg, internal.Options{
+		Namespace:   conf.Metrics.Namespace,
+		UsageLabels: usageLabelNames(conf),
+		Labels:      configuredLabelNames(conf),
+		CostBuckets: conf.Metrics.CostBuckets,
+		Timestamps:  conf.Metrics.OpenMetrics,
+		Tenants:     conf.TenantNames(),
+		StaleAfter:  time.Duration(conf.Metrics.Staleness.MaxAge) * time.Second,
+		DropStale:   conf.Metrics.Staleness.Policy == "drop",
+	})
+	if err != nil {
+		logger.Fatal("failed to register metrics", zap.Error(err))
+	}
+	internal.BuildInfo.WithLabelValues(version, commit, runtime.Version()).Set(1)
+	if conf.StateFile != "" {
+		restoreState(conf)
+	}
 
+	scheduler, err := newScheduler(conf)
+	if err != nil {
+		logger.Fatal("invalid worker schedule", zap.Error(err))
+	}
+
+	reloader := config.NewReloader(conf, override, logger)
 	app := fiber.New(fiber.Config{DisableStartupMessage: true})
-	app.Use(pprof.New())
-	metricsHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		collectMu.RLock()
-		defer collectMu.RUnlock()
-		promhttp.Handler().ServeHTTP(w, r)
+	api.New(&snapshots, periodHistory{reloader: reloader}).Register(app)
+	ui.New(&snapshots, collectionHealth{}).Register(app)
+
+	var receiver *webhook.Receiver
+	if conf.Webhook.Secret != "" {
+		receiver = webhook.New(conf.Webhook.Secret, conf.Webhook.Events, logger)
+		app.Post("/webhooks/github", receiver.Handle)
+	}
+
+	// Metrics, profiling and health checks get their own listener so network
+	// policies can expose the API without them. Configuring both on the same
+	// address serves everything from one listener.
+	admin := app
+	if conf.Admin.ListenAddr != conf.ListenAddr {
+		admin = fiber.New(fiber.Config{DisableStartupMessage: true})
+	}
+	if conf.Admin.Pprof {
+		admin.Use("/debug/pprof", adminAuth(conf.Admin.Token))
+		admin.Use(pprof.New())
+	}
+	admin.Get("/debug/config", adminAuth(conf.Admin.Token), func(c *fiber.Ctx) error {
+		return c.JSON(reloader.Current().Redacted())
 	})
-	app.Get("/metrics", adaptor.HTTPHandler(metricsHandler))
+	if conf.Admin.CaptureResponses > 0 {
+		responses = github.NewResponseRing(conf.Admin.CaptureResponses)
+		admin.Get("/debug/github/responses", adminAuth(conf.Admin.Token), func(c *fiber.Ctx) error {
+			return c.JSON(responses.Responses(c.Query("user")))
+		})
+	}
+	// OpenMetrics is negotiated through the Accept header, so plain
+	// Prometheus text scrapers keep working when it is enabled.
+	metricsHandler := promhttp.InstrumentMetricHandler(registry,
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+			EnableOpenMetrics:                   conf.Metrics.OpenMetrics,
+			EnableOpenMetricsTextCreatedSamples: conf.Metrics.OpenMetrics,
+		}))
+	admin.Get("/metrics", staleGuard(conf), adaptor.HTTPHandler(metricsHandler))
+	admin.Get("/rules/prometheus.yaml", func(c *fiber.Ctx) error {
+		out, err := rules.Generate(ruleOptions(reloader.Current()))
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, "application/yaml")
+		return c.Send(out)
+	})
+	admin.Get("/healthz", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	admin.Get("/readyz", func(c *fiber.Ctx) error {
+		if reasons := notReadyReasons(); len(reasons) > 0 {
+			return c.Status(fiber.StatusServiceUnavailable).SendString(strings.Join(reasons, "\n"))
+		}
+		return c.SendString("ok")
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	go worker(conf)
+	if *once {
+		if err := runOnce(ctx, conf); err != nil {
+			logger.Fatal("collection failed", zap.Error(err))
+		}
+		return
+	}
+
+	go reloader.Run(ctx)
+
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		worker(ctx, reloader, scheduler, receiver)
+	}()
+
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		go watchdog(ctx, interval)
+	}
 
-	if err := app.Listen(":8080"); err != nil {
+	go func() {
+		<-ctx.Done()
+		logger.Info("shutting down")
+		if err := systemd.Notify("STOPPING=1"); err != nil {
+			logger.Warn("failed to notify systemd", zap.Error(err))
+		}
+		if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+			logger.Error("failed to shut down http server", zap.Error(err))
+		}
+		if admin != app {
+			if err := admin.ShutdownWithTimeout(shutdownTimeout); err != nil {
+				logger.Error("failed to shut down admin http server", zap.Error(err))
+			}
+		}
+	}()
+
+	if admin != app {
+		go func() {
+			if err := admin.Listen(conf.Admin.ListenAddr); err != nil {
+				logger.Fatal("failed to listen on admin address", zap.String("addr", conf.Admin.ListenAddr), zap.Error(err))
+			}
+		}()
+	}
+	if err := app.Listen(conf.ListenAddr); err != nil {
 		panic(err)
 	}
+	<-workerDone
 }
 
-func worker(conf config.Config) {
-	sleepInterval := time.Duration(conf.WorkerInterval) * time.Second
-	client := github.NewClient(conf.Github.Token, logger)
+// buildInfo returns the version and commit set at build time, falling back
+// to what the Go toolchain recorded for builds without -ldflags.
+func buildInfo() (string, string) {
+	v, c := version, commit
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" {
+			v = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && c == "" {
+				c = s.Value
+			}
+		}
+	}
+	if v == "" {
+		v = "unknown"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	return v, c
+}
 
-	for {
-		logger.Info("collecting copilot premium usage metrics")
+// ruleOptions describes the metrics as registered from conf to the rule
+// generator. Data counts as stale past metrics.staleness.maxAge, or three
+// worker intervals without it.
+func ruleOptions(conf config.Config) rules.Options {
+	var labels []string
+	if len(conf.Tenants) > 0 {
+		labels = append(labels, "tenant")
+	}
+	labels = append(labels, slices.Sorted(maps.Keys(conf.Metrics.ExtraLabels))...)
+	staleAfter := time.Duration(conf.Metrics.Staleness.MaxAge) * time.Second
+	if staleAfter == 0 {
+		staleAfter = 3 * time.Duration(conf.WorkerInterval) * time.Second
+	}
+	return rules.Options{
+		Namespace:     conf.Metrics.Namespace,
+		Labels:        labels,
+		UsageLabels:   internal.UsageLabels(),
+		StaleAfter:    staleAfter,
+		MonthlyBudget: conf.Rules.MonthlyBudget,
+	}
+}
+
+// staleGuard answers 503 instead of serving metrics once the latest published
+// cycle is older than metrics.staleness.maxAge, with the unavailable policy.
+func staleGuard(conf config.Config) fiber.Handler {
+	maxAge := time.Duration(conf.Metrics.Staleness.MaxAge) * time.Second
+	return func(c *fiber.Ctx) error {
+		if maxAge == 0 || conf.Metrics.Staleness.Policy != "unavailable" {
+			return c.Next()
+		}
+		if age, ok := internal.OldestDataAge(); ok && age > maxAge {
+			return c.Status(fiber.StatusServiceUnavailable).SendString(
+				fmt.Sprintf("latest collection is %s old, exceeding the maximum of %s", age.Round(time.Second), maxAge))
+		}
+		return c.Next()
+	}
+}
+
+// adminAuth requires "Authorization: Bearer <token>" on the routes it guards.
+// An empty token leaves them open.
+func adminAuth(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token == "" {
+			return c.Next()
+		}
+		got, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		return c.Next()
+	}
+}
+
+func newScheduler(conf config.Config) (*schedule.Scheduler, error) {
+	return schedule.New(
+		time.Duration(conf.WorkerInterval)*time.Second,
+		conf.Schedule,
+		time.Duration(conf.WorkerJitter)*time.Second,
+	)
+}
 
-		if err := collect(client, conf.Github.Enterprise); err != nil {
-			logger.Error("failed to collect metrics", zap.Error(err))
+// newClient builds the client for the named tenant, "" in a single-tenant
+// deployment.
+func newClient(conf config.Config, tenant string) *github.Client {
+	var opts []github.Option
+	if conf.Github.BaseURL != "" {
+		opts = append(opts, github.WithBaseURL(conf.Github.BaseURL))
+	}
+	if len(conf.Github.Tokens) > 0 {
+		opts = append(opts, github.WithTokens(conf.Github.Tokens...))
+	}
+	if conf.Github.PageSize > 0 {
+		opts = append(opts, github.WithPageSize(conf.Github.PageSize))
+	}
+	if conf.Github.RateLimit.RequestsPerSecond > 0 {
+		opts = append(opts, github.WithRateLimit(conf.Github.RateLimit.RequestsPerSecond, conf.Github.RateLimit.Burst))
+	}
+	if responses != nil {
+		opts = append(opts, github.WithResponseCapture(responses))
+	}
+	if tenant != "" {
+		opts = append(opts, github.WithTokenPrefix(tenant))
+	}
+	opts = append(opts, github.WithTransport(github.TransportConfig{
+		MaxIdleConns:        conf.Github.Transport.MaxIdleConns,
+		MaxIdleConnsPerHost: conf.Github.Transport.MaxIdleConnsPerHost,
+		IdleConnTimeout:     time.Duration(conf.Github.Transport.IdleConnTimeout) * time.Second,
+		DisableHTTP2:        conf.Github.Transport.DisableHTTP2,
+	}))
+	return github.NewClient(conf.Github.Token, logger, opts...)
+}
+
+// newSource returns the usage source selected by source.kind, which is
+// client itself for the REST API.
+func newSource(conf config.Config, client *github.Client) (source.UsageSource, error) {
+	switch conf.Source.Kind {
+	case "rest":
+		return client, nil
+	case "replay":
+		if conf.Source.ReplayFile == "" {
+			return nil, fmt.Errorf("source kind replay needs source.replayFile")
+		}
+		return source.NewReplay(conf.Source.ReplayFile), nil
+	default:
+		return nil, fmt.Errorf("unknown source kind %q", conf.Source.Kind)
+	}
+}
+
+// newPipeline assembles the enrichment stages enabled in conf. client may be
+// nil when only the resulting label names are needed.
+func newPipeline(conf config.Config, client *github.Client) *enrich.Pipeline {
+	var stages []enrich.Enricher
+	// Directory lookups are keyed by corporate email and the org label comes
+	// from memberships, so they need the identity stage even when its own
+	// labels are disabled.
+	needsIdentity := conf.Org.Label || conf.LDAP.URL != "" || len(conf.Entra.Groups) > 0
+	if conf.Identity.Email || conf.Identity.EmployeeIDAttribute != "" || needsIdentity {
+		stages = append(stages, enrich.NewIdentity(
+			client,
+			conf.Github.Enterprise,
+			time.Duration(conf.Identity.RefreshInterval)*time.Second,
+			conf.Identity.Email,
+			conf.Identity.EmployeeIDAttribute,
+		))
+	}
+	if conf.Org.Label {
+		stages = append(stages, enrich.NewOrg(conf.Org.Strategy, conf.Org.Preferred))
+	}
+	if conf.Bots.Mode == "label" {
+		accounts, _ := enrich.NewAccountType(conf.Bots.Patterns)
+		stages = append(stages, accounts)
+	}
+	if conf.LDAP.URL != "" {
+		stages = append(stages, enrich.NewLDAP(enrich.LDAPConfig{
+			URL:                 conf.LDAP.URL,
+			BindDN:              conf.LDAP.BindDN,
+			BindPassword:        conf.LDAP.BindPassword,
+			BaseDN:              conf.LDAP.BaseDN,
+			Filter:              conf.LDAP.Filter,
+			DepartmentAttribute: conf.LDAP.DepartmentAttribute,
+			ManagerAttribute:    conf.LDAP.ManagerAttribute,
+			ManagerLabel:        conf.LDAP.ManagerLabel,
+			Refresh:             time.Duration(conf.LDAP.RefreshInterval) * time.Second,
+		}))
+	}
+	if len(conf.Entra.Groups) > 0 {
+		stages = append(stages, enrich.NewEntra(enrich.EntraConfig{
+			TenantID:           conf.Entra.TenantID,
+			ClientID:           conf.Entra.ClientID,
+			ClientSecret:       conf.Entra.ClientSecret,
+			FederatedTokenFile: conf.Entra.FederatedTokenFile,
+			Groups:             conf.Entra.Groups,
+			Refresh:            time.Duration(conf.Entra.RefreshInterval) * time.Second,
+		}))
+	}
+	return enrich.NewPipeline(logger, stages...)
+}
+
+// newSinks opens the snapshot sinks enabled in conf for tenant. A sink that
+// cannot be set up is logged and left out.
+func newSinks(ctx context.Context, conf config.Config, tenant string) *sink.Fanout {
+	// The first tenant's push sinks also carry the process-wide gauges, so
+	// they are not sent once per tenant.
+	processWide := len(conf.Tenants) == 0 || conf.Tenants[0].Name == tenant
+	var sinks []sink.Sink
+	if bq := conf.Sinks.BigQuery; bq.Table != "" {
+		s, err := sink.NewBigQuery(ctx, bq.Project, bq.Dataset, bq.Table)
+		if err != nil {
+			logger.Error("failed to set up bigquery sink", zap.Error(err))
 		} else {
-			logger.Info("metrics published")
+			sinks = append(sinks, s)
+		}
+	}
+	if sf := conf.Sinks.Snowflake; sf.Table != "" {
+		s, err := sink.NewSnowflake(sf.DSN, sf.Table)
+		if err != nil {
+			logger.Error("failed to set up snowflake sink", zap.Error(err))
+		} else {
+			sinks = append(sinks, s)
+		}
+	}
+	if kc := conf.Sinks.Kafka; kc.Topic != "" {
+		s, err := sink.NewKafka(sink.KafkaConfig{
+			Brokers:       kc.Brokers,
+			Topic:         kc.Topic,
+			ChangedOnly:   kc.ChangedOnly,
+			TLS:           kc.TLS,
+			SASLMechanism: kc.SASLMechanism,
+			Username:      kc.Username,
+			Password:      kc.Password,
+			Calendar:      calendar(conf),
+			StateFile:     kafkaStateFile(conf, tenant),
+		})
+		if err != nil {
+			logger.Error("failed to set up kafka sink", zap.Error(err))
+		} else {
+			sinks = append(sinks, s)
+		}
+	}
+	if sd := conf.Sinks.StatsD; sd.Address != "" {
+		s, err := sink.NewStatsD(sd.Address, sd.Tags, registry, processWide)
+		if err != nil {
+			logger.Error("failed to set up statsd sink", zap.Error(err))
+		} else {
+			sinks = append(sinks, s)
+		}
+	}
+	if dd := conf.Sinks.Datadog; dd.APIKey != "" {
+		sinks = append(sinks, sink.NewDatadog(sink.DatadogConfig{
+			APIKey:      dd.APIKey,
+			Site:        dd.Site,
+			Tags:        dd.Tags,
+			TagMapping:  dd.TagMapping,
+			ProcessWide: processWide,
+		}, registry))
+	}
+	if ar := conf.Sinks.Archive; ar.Output != "" {
+		s, err := sink.NewArchive(ctx, ar.Output, ar.Format)
+		if err != nil {
+			logger.Error("failed to set up archive sink", zap.Error(err))
+		} else {
+			sinks = append(sinks, s)
+		}
+	}
+	return sink.NewFanout(logger, sinks...)
+}
+
+// worker runs a full collection cycle of every tenant in turn on each
+// scheduled tick. receiver may be nil; when set, webhook deliveries in between
+// trigger partial cycles that only refetch the affected users.
+func worker(ctx context.Context, reloader *config.Reloader, scheduler *schedule.Scheduler, receiver *webhook.Receiver) {
+	conf := reloader.Current()
+	tenants := newTenants(ctx, conf)
+	defer func() {
+		for _, t := range tenants {
+			t.close()
+		}
+	}()
+
+	var triggered <-chan struct{}
+	if receiver != nil {
+		triggered = receiver.Triggered()
+	}
+	// only is the set of users to refetch in a partial cycle, nil for a full
+	// one. Deliveries do not say which tenant a user belongs to, so it
+	// applies to all of them. The schedule stays anchored on the last full
+	// cycle.
+	var only map[string]bool
+	// hotRefresh is whether the cycle only recollects each tenant's hot
+	// users, such as its top spenders.
+	hotRefresh := false
+	// fullSlot anchors the schedule: the slot of the last full cycle, or its
+	// start if it was not scheduled. scheduled is whether the upcoming cycle
+	// is the one due in slot.
+	var fullSlot, slot time.Time
+	scheduled := false
+	// ready is whether systemd has been told the service is up, which waits
+	// for the first cycle in which every tenant succeeded.
+	ready := false
+
+	for {
+		if latest := reloader.Current(); !reflect.DeepEqual(latest, conf) {
+			conf = latest
+			reconfigure(ctx, tenants, conf)
 		}
 
-		time.Sleep(sleepInterval)
+		cycle := newCycleID()
+		switch {
+		case hotRefresh:
+			logger.Info("recollecting copilot premium usage for top spenders", zap.String("cycle", cycle))
+		case only == nil:
+			logger.Info("collecting copilot premium usage metrics", zap.String("cycle", cycle))
+		default:
+			logger.Info("recollecting copilot premium usage for users changed by webhook", zap.String("cycle", cycle), zap.Int("users", len(only)))
+		}
+
+		start := time.Now()
+		deadline := start.Add(time.Duration(conf.CycleDeadline) * time.Second)
+		overdueAt.Store(deadline.Add(watchdogGrace).UnixNano())
+		failed := 0
+		for _, t := range tenants {
+			var err error
+			if hotRefresh {
+				users := t.hotUsers()
+				if len(users) == 0 {
+					continue
+				}
+				err = runHotRefresh(ctx, t, cycle, users, deadline)
+			} else {
+				err = runCycle(ctx, t, cycle, only, deadline)
+			}
+			if err != nil {
+				failed++
+			}
+			if ctx.Err() != nil {
+				logger.Info("collection interrupted by shutdown", zap.String("cycle", cycle))
+				return
+			}
+		}
+		overdueAt.Store(0)
+		// A hot refresh is no cycle to report, nor proof that collection works.
+		if !hotRefresh {
+			notifyCycle(len(tenants), failed, !ready)
+			ready = ready || failed == 0
+		}
+
+		if only == nil && !hotRefresh {
+			fullSlot = start
+			if scheduled {
+				fullSlot = slot
+			}
+		}
+
+		// A wake-up by a webhook whose request an earlier Take has already
+		// served needs no cycle, so the worker goes back to waiting without
+		// moving the anchor of the schedule.
+	wait:
+		for {
+			var reason wakeReason
+			scheduler, reason, slot = waitForNextCycle(ctx, reloader, scheduler, triggered, fullSlot, time.Duration(conf.HotRefresh.Interval)*time.Second)
+			only, hotRefresh = nil, false
+			scheduled = reason == wakeScheduled
+			switch reason {
+			case wakeShutdown:
+				return
+			case wakeHotRefresh:
+				hotRefresh = true
+				break wait
+			}
+			if receiver == nil {
+				break
+			}
+			if !scheduled {
+				select {
+				case <-time.After(webhookSettleDelay):
+				case <-ctx.Done():
+					return
+				}
+			}
+			req := receiver.Take()
+			if req.Seats {
+				for _, t := range tenants {
+					t.seats = nil
+				}
+			}
+			// A full cycle covers whatever webhooks asked for meanwhile.
+			if scheduled || req.All {
+				break
+			}
+			if len(req.Users) == 0 {
+				continue
+			}
+			only = make(map[string]bool, len(req.Users))
+			for _, login := range req.Users {
+				only[login] = true
+			}
+			break
+		}
 	}
 }
 
-func collect(client *github.Client, enterprise string) error {
-	logins, err := client.ListCopilotSeats(enterprise)
+// newCycleID returns a random ID correlating the log lines, API calls and
+// audit summaries of one cycle.
+func newCycleID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tracer starts the span of each collection cycle, under which the spans of
+// its GitHub requests nest.
+var tracer = otel.Tracer("go.dfds.cloud/copilot-premium-usage-exporter/cmd")
+
+// notifyCycle reports a finished cycle to systemd, sending READY=1 along with
+// it when sendReady is set and the cycle succeeded.
+func notifyCycle(tenants, failed int, sendReady bool) {
+	state := fmt.Sprintf("STATUS=last cycle at %s: %d of %d tenants collected", time.Now().UTC().Format(time.RFC3339), tenants-failed, tenants)
+	if sendReady && failed == 0 {
+		state = "READY=1\n" + state
+	}
+	if err := systemd.Notify(state); err != nil {
+		logger.Warn("failed to notify systemd", zap.Error(err))
+	}
+}
+
+// watchdog pings the systemd watchdog at half its interval for as long as the
+// worker is waiting or its running cycle is not overdue, so a wedged worker
+// loop gets the service restarted.
+func watchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if at := overdueAt.Load(); at != 0 && time.Now().After(time.Unix(0, at)) {
+			logger.Error("collection cycle is overdue, withholding systemd watchdog ping",
+				zap.Time("overdueAt", time.Unix(0, at)))
+			continue
+		}
+		if err := systemd.Notify("WATCHDOG=1"); err != nil {
+			logger.Warn("failed to notify systemd", zap.Error(err))
+		}
+	}
+}
+
+// runOnce collects every tenant a single time and writes the resulting
+// metrics to stdout in the Prometheus text format.
+func runOnce(ctx context.Context, conf config.Config) error {
+	tenants := newTenants(ctx, conf)
+	defer func() {
+		for _, t := range tenants {
+			t.close()
+		}
+	}()
+
+	cycle := newCycleID()
+	deadline := time.Now().Add(time.Duration(conf.CycleDeadline) * time.Second)
+	var errs []error
+	for _, t := range tenants {
+		if err := runCycle(ctx, t, cycle, nil, deadline); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	families, err := registry.Gather()
 	if err != nil {
-		return fmt.Errorf("listing copilot seats: %w", err)
+		return fmt.Errorf("gathering metrics: %w", err)
+	}
+	enc := expfmt.NewEncoder(os.Stdout, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			return fmt.Errorf("writing metrics: %w", err)
+		}
 	}
+	return errors.Join(errs...)
+}
+
+// runCycle collects and publishes one tenant, then hands the result to its
+// sinks and the audit trail. Fetching stops at deadline. Everything logged
+// along the way carries the cycle ID. The returned error is also in the
+// audit summary.
+func runCycle(ctx context.Context, t *tenant, cycle string, only map[string]bool, deadline time.Time) error {
+	conf := t.conf
+	log := t.logger.With(zap.String("cycle", cycle))
+	ctx, span := tracer.Start(logctx.With(ctx, log), "collection cycle", trace.WithAttributes(
+		attribute.String("cycle", cycle),
+		attribute.String("tenant", t.name),
+		attribute.String("enterprise", conf.Github.Enterprise),
+		attribute.Bool("partial", only != nil),
+	))
+	defer span.End()
+	summary := audit.Summary{Cycle: cycle, Tenant: t.name, Enterprise: conf.Github.Enterprise, Partial: only != nil, StartedAt: time.Now()}
+	before := t.client.Stats()
 
-	logger.Info("found copilot seat holders", zap.Int("count", len(logins)))
+	var err error
+	if !t.preflighted {
+		err = preflight(ctx, t)
+		t.preflighted = err == nil
+	}
+	if err == nil {
+		err = collect(ctx, t, only, deadline, &summary)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		log.Error("failed to collect metrics", zap.Error(err))
+	} else {
+		log.Info("metrics published")
+		t.sinks.Write(ctx, snapshots.Tenant(t.name))
+	}
 
-	var entries []metricEntry
-	for _, login := range logins {
-		usage, err := client.GetUserPremiumUsage(enterprise, login)
+	after := t.client.Stats()
+	summary.APICalls = after.Requests - before.Requests
+	summary.RateLimitConsumed = after.RateLimitConsumedSince(before)
+	summary.Finish(time.Now(), err)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	lastCycles.Store(t.name, summary)
+	internal.ObserveWithExemplar(internal.CollectionDuration.WithLabelValues(summary.Enterprise), summary.DurationSeconds,
+		internal.Exemplar(ctx, prometheus.Labels{"cycle": cycle}))
+
+	logger.Info("collection summary", summary.Fields()...)
+	if conf.AuditFile != "" {
+		if err := audit.NewFileSink(conf.AuditFile).Write(summary); err != nil {
+			log.Error("failed to write audit summary", zap.Error(err))
+		}
+	}
+	return err
+}
+
+// runHotRefresh runs refreshHot for users of t as part of cycle. Hot
+// refreshes are too frequent for the audit log and the cycle duration
+// histogram, which only cover full and partial cycles.
+func runHotRefresh(ctx context.Context, t *tenant, cycle string, users map[string]bool, deadline time.Time) error {
+	log := t.logger.With(zap.String("cycle", cycle))
+	ctx, span := tracer.Start(logctx.With(ctx, log), "hot refresh", trace.WithAttributes(
+		attribute.String("cycle", cycle),
+		attribute.String("tenant", t.name),
+		attribute.String("enterprise", t.conf.Github.Enterprise),
+		attribute.Int("users", len(users)),
+	))
+	defer span.End()
+
+	var summary audit.Summary
+	err := refreshHot(ctx, t, users, deadline, &summary)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		log.Error("failed to refresh hot users", zap.Error(err))
+		return err
+	}
+	log.Info("hot users refreshed",
+		zap.Int("users", len(users)),
+		zap.Int("succeeded", summary.UsersSucceeded),
+		zap.Int("failed", summary.UsersFailed),
+	)
+	return nil
+}
+
+// notReadyReasons returns why /readyz fails, sorted, prefixed by tenant in
+// a multi-tenant deployment.
+func notReadyReasons() []string {
+	var reasons []string
+	notReady.Range(func(tenant, reason any) bool {
+		if tenant != "" {
+			reason = fmt.Sprintf("%s: %s", tenant, reason)
+		}
+		reasons = append(reasons, reason.(string))
+		return true
+	})
+	slices.Sort(reasons)
+	return reasons
+}
+
+// collectionHealth serves the web UI the latest cycle of each tenant and the
+// readiness of the exporter.
+type collectionHealth struct{}
+
+func (collectionHealth) Cycles() []audit.Summary {
+	var cycles []audit.Summary
+	lastCycles.Range(func(_, summary any) bool {
+		cycles = append(cycles, summary.(audit.Summary))
+		return true
+	})
+	slices.SortFunc(cycles, func(a, b audit.Summary) int { return strings.Compare(a.Tenant, b.Tenant) })
+	return cycles
+}
+
+func (collectionHealth) NotReady() []string {
+	return notReadyReasons()
+}
+
+// preflight validates the tokens and enterprise before the first collection
+// with a client, so a misconfiguration surfaces as one actionable error and a
+// failing readiness probe instead of a warning per user. With
+// preflight.failFast set the process exits instead. Sources without checks of
+// their own pass immediately.
+func preflight(ctx context.Context, t *tenant) error {
+	logger := logctx.From(ctx, t.logger)
+	p, ok := t.src.(source.Preflighter)
+	if !ok {
+		notReady.Delete(t.name)
+		return nil
+	}
+	err := p.Preflight(ctx, t.conf.Github.Enterprise)
+	if err != nil {
+		if ctx.Err() == nil && t.conf.Preflight.FailFast {
+			logger.Fatal("preflight checks failed", zap.Error(err))
+		}
+		notReady.Store(t.name, err.Error())
+		return fmt.Errorf("preflight checks failed, skipping collection: %w", err)
+	}
+	notReady.Delete(t.name)
+	logger.Info("preflight checks passed")
+	return nil
+}
+
+// wakeReason is why waitForNextCycle returned.
+type wakeReason int
+
+const (
+	wakeShutdown wakeReason = iota
+	wakeScheduled
+	wakeWebhook
+	wakeHotRefresh
+)
+
+// waitForNextCycle sleeps until the cycle after the one in slot prev,
+// recomputing the schedule whenever the configuration is reloaded meanwhile,
+// until triggered receives, or for hot if that is shorter and not zero. It
+// returns the scheduler in effect, which an invalid reload leaves unchanged,
+// why it woke, and the slot of the next scheduled cycle.
+func waitForNextCycle(ctx context.Context, reloader *config.Reloader, scheduler *schedule.Scheduler, triggered <-chan struct{}, prev time.Time, hot time.Duration) (*schedule.Scheduler, wakeReason, time.Time) {
+	var hotC <-chan time.Time
+	if hot > 0 {
+		hotTimer := time.NewTimer(hot)
+		defer hotTimer.Stop()
+		hotC = hotTimer.C
+	}
+	for {
+		slot, at := scheduler.Next(prev, time.Now())
+		logger.Debug("next collection scheduled", zap.Time("at", at))
+
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return scheduler, wakeShutdown, slot
+		case <-timer.C:
+			return scheduler, wakeScheduled, slot
+		case <-triggered:
+			timer.Stop()
+			return scheduler, wakeWebhook, slot
+		case <-hotC:
+			timer.Stop()
+			return scheduler, wakeHotRefresh, slot
+		case <-reloader.Updated():
+			timer.Stop()
+			updated, err := newScheduler(reloader.Current())
+			if err != nil {
+				logger.Error("invalid worker schedule in reloaded configuration, keeping current", zap.Error(err))
+				continue
+			}
+			scheduler = updated
+		}
+	}
+}
+
+// collect fetches usage for every seat holder of t from its source and
+// republishes all of t's metrics. When only is non-nil, users outside it keep
+// their entries from the previous cycle unless those were themselves stale.
+// Users not fetched by deadline keep their previous entries as stale and
+// the cycle is published as incomplete. t's client serves the enterprise
+// billing endpoints, which are not part of the source.
+func collect(ctx context.Context, t *tenant, only map[string]bool, deadline time.Time, summary *audit.Summary) error {
+	conf, logger := t.conf, logctx.From(ctx, t.logger)
+	enterprise := conf.Github.Enterprise
+
+	// Only fetching usage is bounded by the deadline. Listing carries on
+	// past it, so the holders on the remaining pages keep their previous
+	// values, and publishing what was fetched must not be cut short by it.
+	fetchCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	// Seats are enriched, fetched and turned into series a page at a time,
+	// so besides what is published only one page of seats and their users
+	// is held however large the enterprise.
+	c := newCollection(t, only, summary, logger)
+	totalSeats := t.totalSeats
+	if only != nil && t.seats != nil {
+		// A partial cycle goes through the seats of the previous cycle, unless
+		// a webhook has since said they changed.
+		for seats := range slices.Chunk(t.seats, seatBatch) {
+			if err := c.add(ctx, fetchCtx, seats); err != nil {
+				return err
+			}
+		}
+	} else {
+		listed := 0
+		var pageErr error
+		err := source.EachSeatPage(ctx, t.src, enterprise, func(seats []github.CopilotSeat, total int) error {
+			listed += len(seats)
+			totalSeats = total
+			pageErr = c.add(ctx, fetchCtx, seats)
+			return pageErr
+		})
+		if pageErr != nil {
+			return pageErr
+		}
 		if err != nil {
-			logger.Warn("failed to get usage for user", zap.String("user", login), zap.Error(err))
+			return fmt.Errorf("listing copilot seats: %w", err)
+		}
+
+		logger.Info("found copilot seat holders", zap.Int("count", listed), zap.Int("totalSeats", totalSeats))
+		if listed != totalSeats {
+			logger.Warn("listed seat holders do not match total seats reported by github",
+				zap.Int("listed", listed),
+				zap.Int("totalSeats", totalSeats),
+			)
+		}
+	}
+	if c.excluded > 0 {
+		logger.Info("excluded bot accounts from collection", zap.Int("excluded", c.excluded))
+	}
+	if c.unfetched > 0 {
+		summary.Incomplete = true
+		logger.Warn("cycle deadline reached, publishing partial results",
+			zap.Time("deadline", deadline),
+			zap.Int("unfetched", c.unfetched),
+		)
+	}
+	c.keep()
+	t.totalSeats, t.incomplete = totalSeats, summary.Incomplete
+
+	set, snap, now, period := c.set, c.snap, c.now, c.period
+	t.anomalies.Prune(now)
+	t.anomalous, t.scores = c.flagged, c.scores
+	c.setTenantSeries()
+	collectEnterpriseBilling(ctx, t, period, set, true)
+	set.Set(internal.EnterpriseCostForecast, billing.Forecast(c.enterpriseNet, period, now, conf.Forecast.WeekdayAware), enterprise)
+
+	// Publish consumes the set, so it is saved first.
+	if conf.StateFile != "" {
+		if err := saveState(stateFile(conf, t.name), snap, set); err != nil {
+			logger.Error("failed to save state", zap.Error(err))
+		}
+		if err := saveTenant(tenantStateFile(conf, t.name), t); err != nil {
+			logger.Error("failed to save tenant state", zap.Error(err))
+		}
+	}
+	if err := internal.Publish(set); err != nil {
+		return fmt.Errorf("publishing metrics: %w", err)
+	}
+	// The first cycle of a billing period closes the previous one, whose last
+	// snapshot is the final word on it.
+	if prev := snapshots.Tenant(t.name); prev != nil {
+		if prevPeriod := calendar(conf).MonthOf(prev.CollectedAt); !prevPeriod.Start.Equal(period.Start) {
+			if conf.Chargeback.Output != "" {
+				if err := writeChargeback(ctx, conf, prev, prevPeriod); err != nil {
+					logger.Error("failed to write chargeback statement", zap.Error(err), zap.Time("period", prevPeriod.Start))
+				}
+			}
+			if conf.StateFile != "" {
+				if err := savePeriod(periodFile(conf, t.name, prevPeriod.Start.Format("2006-01")), prev); err != nil {
+					logger.Error("failed to save snapshot of closed period", zap.Error(err), zap.Time("period", prevPeriod.Start))
+				}
+			}
+		}
+	}
+	snapshots.Set(snap)
+
+	return nil
+}
+
+// seatBatch is how many cached seats a hot refresh or partial cycle enriches
+// and fetches at a time, as a page of listed seats would be.
+const seatBatch = 100
+
+// refreshHot refetches t's hot users and republishes t's metrics from the
+// seats, entries and enterprise billing of the previous cycle. Nothing else
+// is fetched, and the sinks, the saved state and the anomaly baselines wait
+// for the next full cycle.
+func refreshHot(ctx context.Context, t *tenant, users map[string]bool, deadline time.Time, summary *audit.Summary) error {
+	logger := logctx.From(ctx, t.logger)
+	fetchCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	c := newCollection(t, users, summary, logger)
+	c.hot = true
+	for seats := range slices.Chunk(t.seats, seatBatch) {
+		if err := c.add(ctx, fetchCtx, seats); err != nil {
+			return err
+		}
+	}
+	if c.unfetched > 0 {
+		logger.Warn("cycle deadline reached, publishing partial results",
+			zap.Time("deadline", deadline),
+			zap.Int("unfetched", c.unfetched),
+		)
+	}
+	c.keep()
+
+	c.setTenantSeries()
+	collectEnterpriseBilling(ctx, t, c.period, c.set, false)
+	c.set.Set(internal.EnterpriseCostForecast, billing.Forecast(c.enterpriseNet, c.period, c.now, t.conf.Forecast.WeekdayAware), t.conf.Github.Enterprise)
+	if err := internal.Publish(c.set); err != nil {
+		return fmt.Errorf("publishing metrics: %w", err)
+	}
+	snapshots.Set(c.snap)
+	return nil
+}
+
+// collection is one cycle of a tenant in progress: the entries kept for the
+// next cycle, and the series and snapshot built so far from the pages of
+// seats added to it. Everything is stamped with the time the cycle started.
+type collection struct {
+	t       *tenant
+	only    map[string]bool
+	summary *audit.Summary
+	logger  *zap.Logger
+	// hot is set for a hot refresh, which leaves the users outside only
+	// exactly as the last cycle found them and the anomaly baselines alone.
+	hot bool
+
+	// accounts classifies seat holders when bots are excluded, else nil.
+	accounts    *enrich.AccountType
+	quotas      billing.Quotas
+	prices      billing.LicensePrices
+	costCenters report.CostCenters
+
+	now    time.Time
+	period billing.Period
+	set    *internal.MetricSet
+	snap   *snapshot.Snapshot
+
+	seats         []github.CopilotSeat
+	current       map[string][]metricEntry
+	stale         map[string]bool
+	failed        map[string]bool
+	flagged       map[string]bool
+	scores        map[string]float64
+	enterpriseNet float64
+	excluded      int
+	unfetched     int
+}
+
+func newCollection(t *tenant, only map[string]bool, summary *audit.Summary, logger *zap.Logger) *collection {
+	conf, now := t.conf, time.Now()
+	c := &collection{
+		t:           t,
+		only:        only,
+		summary:     summary,
+		logger:      logger,
+		quotas:      billing.Quotas{Business: conf.Quota.Business, Enterprise: conf.Quota.Enterprise},
+		prices:      billing.LicensePrices{Business: conf.License.Business, Enterprise: conf.License.Enterprise},
+		costCenters: report.CostCenters{Teams: conf.Chargeback.CostCenters, Default: conf.Chargeback.DefaultCostCenter},
+		now:         now,
+		period:      calendar(conf).MonthOf(now),
+		set:         internal.NewMetricSet(t.name, now),
+		snap:        &snapshot.Snapshot{Tenant: t.name, Enterprise: conf.Github.Enterprise, CollectedAt: now},
+		current:     make(map[string][]metricEntry, len(t.lastGood)),
+		stale:       make(map[string]bool),
+		failed:      make(map[string]bool),
+		flagged:     make(map[string]bool),
+		scores:      make(map[string]float64),
+	}
+	if conf.Bots.Mode == "exclude" {
+		// Validate has compiled the patterns already.
+		c.accounts, _ = enrich.NewAccountType(conf.Bots.Patterns)
+	}
+	return c
+}
+
+// add enriches and fetches the holders of one page of seats and adds their
+// series and snapshot records. Only a canceled ctx stops it; past fetchCtx's
+// deadline holders keep their previous entries.
+func (c *collection) add(ctx, fetchCtx context.Context, seats []github.CopilotSeat) error {
+	kept := make([]github.CopilotSeat, 0, len(seats))
+	users := make([]*enrich.User, 0, len(seats))
+	var fetched []*enrich.User
+	for _, seat := range seats {
+		if c.accounts != nil && c.accounts.Classify(&enrich.User{Login: seat.Assignee.Login, Type: seat.Assignee.Type}) == enrich.AccountTypeBot {
+			c.excluded++
 			continue
 		}
+		user := enrich.NewUser(seat.Assignee.Login)
+		user.Type = seat.Assignee.Type
+		user.Labels["assigning_team"] = seat.AssigningTeamSlug()
+		user.Labels["plan_type"] = seat.PlanType
+		user.Labels["cost_center"] = c.costCenters.For(seat.AssigningTeamSlug())
+		kept = append(kept, seat)
+		users = append(users, user)
+		if !c.reuses(user.Login) {
+			fetched = append(fetched, user)
+		}
+	}
+	// Reused holders keep their previous entries, labels included, and past
+	// the deadline so does everyone, so enriching them would be wasted.
+	if len(fetched) > 0 && fetchCtx.Err() == nil {
+		c.t.pipeline.Enrich(fetchCtx, fetched)
+	}
+
+	for i, user := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if c.fetch(ctx, fetchCtx, user) {
+			c.emit(kept[i])
+		}
+	}
+	return nil
+}
+
+// reuses reports whether login keeps their entries from the previous cycle
+// without being fetched: in a partial cycle those outside only, unless they
+// were stale, and in a hot refresh everyone outside only.
+func (c *collection) reuses(login string) bool {
+	if c.only == nil || c.only[login] {
+		return false
+	}
+	if c.hot {
+		return true
+	}
+	_, ok := c.t.lastGood[login]
+	return ok && !c.t.lastStale[login]
+}
+
+// fetch sets user's entries for this cycle: their usage when it is fetched,
+// else their previous entries if there are any. It reports false if the user
+// has lost their seat since it was listed and is to be left out of
+// everything published.
+func (c *collection) fetch(ctx, fetchCtx context.Context, user *enrich.User) bool {
+	t, summary, logger := c.t, c.summary, c.logger
+	login, enterprise := user.Login, t.conf.Github.Enterprise
+	// retain carries login's entries from the previous cycle over as stale,
+	// reporting whether there were any.
+	retain := func() bool {
+		prev, ok := t.lastGood[login]
+		if ok {
+			summary.UsersRetained++
+			c.stale[login] = true
+			c.current[login] = prev
+		}
+		return ok
+	}
+	if c.reuses(login) {
+		if prev, ok := t.lastGood[login]; ok {
+			summary.UsersReused++
+			c.current[login] = prev
+		}
+		if c.hot {
+			c.stale[login], c.failed[login] = t.lastStale[login], t.lastFailed[login]
+		}
+		return true
+	}
+	if fetchCtx.Err() != nil {
+		c.unfetched++
+		retain()
+		return true
+	}
+	usage, err := t.src.GetUsage(fetchCtx, enterprise, login)
+	if err != nil && ctx.Err() == nil && fetchCtx.Err() != nil {
+		c.unfetched++
+		retain()
+		return true
+	}
+	summary.UsersAttempted++
+	if github.IsUserGone(err) {
+		summary.UsersGone++
+		internal.UsersGone.WithLabelValues(enterprise).Inc()
+		logger.Info("user no longer holds a copilot seat, dropping their series", zap.String("user", login))
+		return false
+	}
+	if err != nil {
+		summary.UsersFailed++
+		c.failed[login] = true
+		internal.UserCollectionFailures.WithLabelValues(enterprise, github.ErrorClass(err)).Inc()
+		if retain() {
+			logger.Warn("failed to get usage for user, keeping previous values", zap.String("user", login), zap.Error(err))
+		} else {
+			logger.Warn("failed to get usage for user", zap.String("user", login), zap.Error(err))
+		}
+		return true
+	}
+	summary.UsersSucceeded++
+
+	userEntries := make([]metricEntry, 0, len(usage.UsageItems))
+	for _, item := range usage.UsageItems {
+		summary.GrossAmount += item.GrossAmount
+		summary.NetAmount += item.NetAmount
+		userEntries = append(userEntries, metricEntry{
+			labelValues: usageLabelValues(user, item, enterprise),
+			item:        item,
+		})
+	}
+	c.current[login] = userEntries
+	return true
+}
+
+// emit adds the series and snapshot records of seat's holder, whose entries
+// fetch has set, and keeps the seat for the next cycles.
+func (c *collection) emit(seat github.CopilotSeat) {
+	conf, set, snap, now := c.t.conf, c.set, c.snap, c.now
+	login, enterprise := seat.Assignee.Login, conf.Github.Enterprise
+	c.seats = append(c.seats, seat)
+
+	value := 0.0
+	if c.failed[login] {
+		value = 1
+	}
+	set.Set(internal.UserCollectionFailed, value, login, enterprise)
+	set.Set(internal.SeatInfo, 1, login, enterprise, seat.AssigningTeamSlug(), seat.PlanType)
+	set.Set(internal.SeatLicenseCost, c.prices.ForPlan(seat.PlanType), login, enterprise, seat.PlanType)
+	snap.Seats = append(snap.Seats, snapshot.Seat{Tenant: c.t.name, User: login, Team: seat.AssigningTeamSlug(), PlanType: seat.PlanType})
+
+	userEntries, ok := c.current[login]
+	if !ok {
+		return
+	}
+	value = 0
+	if c.stale[login] {
+		value = 1
+	}
+	set.Set(internal.UserUsageStale, value, login, enterprise)
+	used := 0.0
+	var items []github.UsageItem
+	for _, e := range userEntries {
+		set.Add(internal.RequestAmount, e.item.GrossQuantity, e.labelValues...)
+		set.Add(internal.RequestCostGross, e.item.GrossAmount, e.labelValues...)
+		set.Add(internal.RequestCostDiscount, e.item.DiscountAmount, e.labelValues...)
+		if e.item.GrossQuantity > 0 {
+			used = 1
+		}
+		items = append(items, e.item)
+		snap.Records = append(snap.Records, snapshot.Record{
+			Tenant:         c.t.name,
+			User:           login,
+			Team:           seat.AssigningTeamSlug(),
+			PlanType:       seat.PlanType,
+			SKU:            e.item.SKU,
+			Model:          e.item.Model,
+			Stale:          c.stale[login],
+			GrossQuantity:  e.item.GrossQuantity,
+			NetQuantity:    e.item.NetQuantity,
+			GrossAmount:    e.item.GrossAmount,
+			DiscountAmount: e.item.DiscountAmount,
+			NetAmount:      e.item.NetAmount,
+		})
+	}
+	if conf.Metrics.HasUsage {
+		set.Set(internal.UserHasUsage, used, login, enterprise)
+	}
+	q := billing.Breakdown(items, c.quotas.ForPlan(seat.PlanType))
+	set.Set(internal.IncludedRequestsQuota, q.Quota, login, enterprise, seat.PlanType)
+	set.Set(internal.IncludedRequestsUsed, q.IncludedUsed, login, enterprise, seat.PlanType)
+	set.Set(internal.QuotaUtilization, q.Utilization, login, enterprise, seat.PlanType)
+	set.Set(internal.OverageRequests, q.OverageRequests, login, enterprise, seat.PlanType)
+	set.Set(internal.OverageCost, q.OverageCost, login, enterprise, seat.PlanType)
+
+	var net, gross float64
+	for _, item := range items {
+		net += item.NetAmount
+		gross += item.GrossAmount
+	}
+	c.enterpriseNet += net
+	set.Observe(internal.UserCostDistribution, net, enterprise)
+	set.Set(internal.UserCostForecast, billing.Forecast(net, c.period, now, conf.Forecast.WeekdayAware), login, enterprise)
 
-		for _, item := range usage.UsageItems {
-			entries = append(entries, metricEntry{
-				labels: prometheus.Labels{
-					"user":       login,
-					"sku":        item.SKU,
-					"model":      item.Model,
-					"enterprise": enterprise,
-				},
-				grossQuantity:  item.GrossQuantity,
-				grossAmount:    item.GrossAmount,
-				discountAmount: item.DiscountAmount,
-			})
+	// Gross spend tracks consumption even while the included quota keeps
+	// the net amount at zero. A hot refresh republishes the scores of the
+	// last cycle, as observing every few minutes would skew the baselines
+	// towards the hot users.
+	if !conf.Anomaly.Enabled {
+		return
+	}
+	score, ok := c.t.scores[login]
+	if !c.hot {
+		score, ok = c.t.anomalies.Observe(login, gross, now)
+	}
+	if ok {
+		c.scores[login] = score
+		anomalous := 0.0
+		if score >= conf.Anomaly.Threshold {
+			anomalous = 1
+			c.flagged[login] = true
 		}
+		set.Set(internal.UserUsageAnomalyScore, score, login, enterprise)
+		set.Set(internal.UserUsageAnomalous, anomalous, login, enterprise)
 	}
+}
 
-	collectMu.Lock()
-	defer collectMu.Unlock()
+// keep stores what the cycle found in t for the next cycles.
+func (c *collection) keep() {
+	t := c.t
+	t.seats, t.lastGood, t.lastStale, t.lastFailed = c.seats, c.current, c.stale, c.failed
+}
 
-	internal.RequestAmount.Reset()
-	internal.RequestCostGross.Reset()
-	internal.RequestCostDiscount.Reset()
+// setTenantSeries adds the seat total and completeness of t's last full
+// cycle to the set.
+func (c *collection) setTenantSeries() {
+	enterprise := c.t.conf.Github.Enterprise
+	c.set.Set(internal.TotalSeats, float64(c.t.totalSeats), enterprise)
+	complete := 1.0
+	if c.t.incomplete {
+		complete = 0
+	}
+	c.set.Set(internal.CollectionComplete, complete, enterprise)
+}
 
-	for _, e := range entries {
-		internal.RequestAmount.With(e.labels).Set(e.grossQuantity)
-		internal.RequestCostGross.With(e.labels).Set(e.grossAmount)
-		internal.RequestCostDiscount.With(e.labels).Set(e.discountAmount)
+// calendar returns the billing calendar of conf, whose timezone Validate has
+// already checked.
+func calendar(conf config.Config) billing.Calendar {
+	loc, err := time.LoadLocation(conf.Billing.Timezone)
+	if err != nil {
+		loc = time.UTC
 	}
+	return billing.Calendar{Location: loc}
+}
 
+// writeChargeback stores the per-team chargeback statement for period, built
+// from snap, in every configured format.
+func writeChargeback(ctx context.Context, conf config.Config, snap *snapshot.Snapshot, period billing.Period) error {
+	logger := logctx.From(ctx, logger)
+	bucket, err := storage.Open(ctx, conf.Chargeback.Output)
+	if err != nil {
+		return err
+	}
+	defer bucket.Close()
+	statement := report.BuildChargeback(snap, period,
+		billing.LicensePrices{Business: conf.License.Business, Enterprise: conf.License.Enterprise},
+		report.CostCenters{Teams: conf.Chargeback.CostCenters, Default: conf.Chargeback.DefaultCostCenter})
+
+	// A named tenant gets its own directory, so tenants sharing a slug on
+	// different hosts do not overwrite each other's statement.
+	dir := ""
+	if snap.Tenant != "" {
+		dir = snap.Tenant + "/"
+	}
+	for _, format := range conf.Chargeback.Formats {
+		var data []byte
+		var contentType string
+		switch format {
+		case "json":
+			data, err = statement.JSON()
+			contentType = "application/json"
+		case "csv":
+			data, err = statement.CSV()
+			contentType = "text/csv"
+		default:
+			return fmt.Errorf("unknown chargeback format %q", format)
+		}
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("chargeback/%s%s/%s.%s", dir, snap.Enterprise, period.Start.Format("2006-01"), format)
+		if err := bucket.Put(ctx, key, data, contentType); err != nil {
+			return err
+		}
+		logger.Info("chargeback statement written", zap.String("key", key), zap.Int("teams", len(statement.Teams)))
+	}
 	return nil
 }
+
+// collectEnterpriseBilling adds the opt-in Actions, Packages and Advanced
+// Security families to set, fetching them again if refetch is set. A failed
+// or skipped fetch keeps the previous values so one bad response does not
+// blank the rest of the bill.
+func collectEnterpriseBilling(ctx context.Context, t *tenant, period billing.Period, set *internal.MetricSet, refetch bool) {
+	conf, client, logger := t.conf, t.client, logctx.From(ctx, t.logger)
+	enterprise := conf.Github.Enterprise
+
+	if conf.Billing.Actions || conf.Billing.Packages {
+		if refetch {
+			items, err := client.GetBillingUsage(ctx, enterprise, period.Start.Year(), int(period.Start.Month()))
+			if err != nil {
+				logger.Warn("failed to get enterprise billing usage, keeping previous values", zap.Error(err))
+			} else {
+				t.lastBilling = items
+			}
+		}
+		items := t.lastBilling
+
+		products := []struct {
+			enabled              bool
+			name                 string
+			quantity, gross, net *internal.Family
+		}{
+			{conf.Billing.Actions, "actions", internal.ActionsUsageQuantity, internal.ActionsUsageCostGross, internal.ActionsUsageCostNet},
+			{conf.Billing.Packages, "packages", internal.PackagesUsageQuantity, internal.PackagesUsageCostGross, internal.PackagesUsageCostNet},
+		}
+		for _, p := range products {
+			if !p.enabled {
+				continue
+			}
+			for _, u := range billing.SumByOrganization(items, p.name) {
+				set.Set(p.quantity, u.Quantity, enterprise, u.Organization, u.SKU, u.UnitType)
+				set.Set(p.gross, u.GrossAmount, enterprise, u.Organization, u.SKU, u.UnitType)
+				set.Set(p.net, u.NetAmount, enterprise, u.Organization, u.SKU, u.UnitType)
+			}
+		}
+	}
+
+	if conf.Billing.AdvancedSecurity {
+		if refetch {
+			committers, err := client.GetAdvancedSecurityCommitters(ctx, enterprise)
+			if err != nil {
+				logger.Warn("failed to get advanced security committers, keeping previous values", zap.Error(err))
+			} else {
+				t.lastCommitters = committers
+			}
+		}
+		if committers := t.lastCommitters; committers != nil {
+			set.Set(internal.AdvancedSecurityCommitters, float64(committers.Total), enterprise)
+			set.Set(internal.AdvancedSecurityCommittersPurchased, float64(committers.Purchased), enterprise)
+		}
+	}
+}
+
+// usageLabelNames returns the optional labels enabled in conf that are added
+// to the per-user usage families.
+func usageLabelNames(conf config.Config) []string {
+	var names []string
+	if conf.Metrics.AssigningTeamLabel {
+		names = append(names, "assigning_team")
+	}
+	return append(names, newPipeline(conf, nil).Labels()...)
+}
+
+// configuredLabelNames returns the usage label set of metrics.labels under
+// the names they are exported as, nil when it is not set.
+func configuredLabelNames(conf config.Config) []string {
+	var names []string
+	for _, name := range conf.Metrics.Labels {
+		switch name {
+		case "team":
+			name = "assigning_team"
+		case "plan":
+			name = "plan_type"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// usageLabelValues builds the label values for one usage item in the order
+// of internal.UsageLabels, leaving enrichment labels the pipeline could not
+// resolve empty.
+func usageLabelValues(user *enrich.User, item github.UsageItem, enterprise string) []string {
+	names := internal.UsageLabels()
+	values := make([]string, len(names))
+	for i, name := range names {
+		switch name {
+		case "user":
+			values[i] = user.Login
+		case "sku":
+			values[i] = item.SKU
+		case "model":
+			values[i] = item.Model
+		case "product":
+			values[i] = item.Product
+		case "unit_type":
+			values[i] = item.UnitType
+		case "enterprise":
+			values[i] = enterprise
+		default:
+			values[i] = user.Labels[name]
+		}
+	}
+	return values
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/anomaly"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/audit"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/config"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/github"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/source"
+	"go.uber.org/zap"
+)
+
+// fakeSource serves seats numbered 0 to seats-1 and their usage from memory,
+// so benchmarks measure collection rather than HTTP.
+type fakeSource struct {
+	seats, perPage int
+}
+
+func (s fakeSource) seat(i int) github.CopilotSeat {
+	seat := github.CopilotSeat{Assignee: github.Assignee{Login: fmt.Sprintf("user-%d", i), Type: "User"}, PlanType: "business"}
+	if i%4 != 0 {
+		seat.AssigningTeam = &github.Team{Slug: fmt.Sprintf("team-%d", i%20)}
+	}
+	return seat
+}
+
+func (s fakeSource) ListSeats(ctx context.Context, enterprise string) ([]github.CopilotSeat, int, error) {
+	seats := make([]github.CopilotSeat, s.seats)
+	for i := range seats {
+		seats[i] = s.seat(i)
+	}
+	return seats, s.seats, nil
+}
+
+func (s fakeSource) EachSeatPage(ctx context.Context, enterprise string, fn func([]github.CopilotSeat, int) error) error {
+	page := make([]github.CopilotSeat, 0, s.perPage)
+	for i := range s.seats {
+		page = append(page, s.seat(i))
+		if len(page) == s.perPage || i == s.seats-1 {
+			if err := fn(page, s.seats); err != nil {
+				return err
+			}
+			page = page[:0]
+		}
+	}
+	return nil
+}
+
+func (s fakeSource) GetUsage(ctx context.Context, enterprise, user string) (*github.UsageResponse, error) {
+	resp := &github.UsageResponse{Enterprise: enterprise, User: user}
+	for _, model := range []string{"GPT-5", "Claude Sonnet 4", "Gemini 2.5 Pro"} {
+		resp.UsageItems = append(resp.UsageItems, github.UsageItem{
+			Product: "Copilot", SKU: "Copilot Premium Request", Model: model, UnitType: "requests",
+			PricePerUnit: 0.04, GrossQuantity: 10, GrossAmount: 0.4, NetQuantity: 10, NetAmount: 0.4,
+		})
+	}
+	return resp, nil
+}
+
+// listedSource hides fakeSource's EachSeatPage, so collection falls back to
+// listing every seat at once.
+type listedSource struct {
+	src fakeSource
+}
+
+func (s listedSource) ListSeats(ctx context.Context, enterprise string) ([]github.CopilotSeat, int, error) {
+	return s.src.ListSeats(ctx, enterprise)
+}
+
+func (s listedSource) GetUsage(ctx context.Context, enterprise, user string) (*github.UsageResponse, error) {
+	return s.src.GetUsage(ctx, enterprise, user)
+}
+
+var registerOnce sync.Once
+
+// newTestTenant returns a tenant collecting from src.
+func newTestTenant(tb testing.TB, src source.UsageSource) *tenant {
+	tb.Helper()
+	conf := config.Config{}
+	conf.Github.Enterprise = "bench"
+	conf.Source.Kind = "rest"
+
+	registerOnce.Do(func() {
+		logger = zap.NewNop()
+		err := internal.Register(prometheus.NewRegistry(), internal.Options{
+			Namespace:   "bench",
+			UsageLabels: usageLabelNames(conf),
+		})
+		if err != nil {
+			tb.Fatal(err)
+		}
+	})
+	t := &tenant{
+		logger:    logger,
+		lastGood:  map[string][]metricEntry{},
+		lastStale: map[string]bool{},
+		anomalies: anomaly.New(conf.Anomaly.Window, conf.Anomaly.MinDays),
+	}
+	t.configure(context.Background(), conf)
+	t.src = src
+	return t
+}
+
+// BenchmarkCollect runs full cycles of enterprises of growing size, seats
+// handed over a page at a time as by the REST client or all at once as by a
+// replay, to keep an eye on how memory grows with the number of seats.
+func BenchmarkCollect(b *testing.B) {
+	for _, seats := range []int{1000, 10000, 50000} {
+		src := fakeSource{seats: seats, perPage: 100}
+		for _, bench := range []struct {
+			name string
+			t    *tenant
+		}{
+			{"paged", newTestTenant(b, src)},
+			{"listed", newTestTenant(b, listedSource{src})},
+		} {
+			t := bench.t
+			b.Run(fmt.Sprintf("%s/seats=%d", bench.name, seats), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					var summary audit.Summary
+					if err := collect(context.Background(), t, nil, time.Now().Add(time.Hour), &summary); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// scriptedSource is a fakeSource that fails the usage of the users in fail
+// and records how often seats were listed and whose usage was fetched.
+type scriptedSource struct {
+	fakeSource
+	fail    map[string]bool
+	lists   int
+	fetched []string
+}
+
+func (s *scriptedSource) EachSeatPage(ctx context.Context, enterprise string, fn func([]github.CopilotSeat, int) error) error {
+	s.lists++
+	return s.fakeSource.EachSeatPage(ctx, enterprise, fn)
+}
+
+func (s *scriptedSource) GetUsage(ctx context.Context, enterprise, user string) (*github.UsageResponse, error) {
+	s.fetched = append(s.fetched, user)
+	if s.fail[user] {
+		return nil, errors.New("boom")
+	}
+	return s.fakeSource.GetUsage(ctx, enterprise, user)
+}
+
+// TestCollect runs a sequence of cycles against the same tenant, checking
+// who each one fetches and whose previous values it carries over.
+func TestCollect(t *testing.T) {
+	src := &scriptedSource{fakeSource: fakeSource{seats: 3, perPage: 2}}
+	tn := newTestTenant(t, src)
+	users := func(logins ...string) map[string]bool {
+		m := make(map[string]bool)
+		for _, login := range logins {
+			m[login] = true
+		}
+		return m
+	}
+
+	steps := []struct {
+		name string
+		// only is the users of a partial cycle or hot refresh.
+		only           []string
+		hot            bool
+		fail           []string
+		invalidate     bool
+		pastDeadline   bool
+		wantFetched    []string
+		wantLists      int
+		wantStale      []string
+		wantFailed     []string
+		wantIncomplete bool
+	}{
+		{
+			name:        "full cycle",
+			wantFetched: []string{"user-0", "user-1", "user-2"},
+			wantLists:   1,
+		},
+		{
+			name:        "failed fetch keeps previous values",
+			fail:        []string{"user-2"},
+			wantFetched: []string{"user-0", "user-1", "user-2"},
+			wantLists:   2,
+			wantStale:   []string{"user-2"},
+			wantFailed:  []string{"user-2"},
+		},
+		{
+			name:        "partial cycle refetches stale users from cached seats",
+			only:        []string{"user-0"},
+			fail:        []string{"user-2"},
+			wantFetched: []string{"user-0", "user-2"},
+			wantLists:   2,
+			wantStale:   []string{"user-2"},
+			wantFailed:  []string{"user-2"},
+		},
+		{
+			name:        "hot refresh leaves everyone else alone",
+			only:        []string{"user-1"},
+			hot:         true,
+			wantFetched: []string{"user-1"},
+			wantLists:   2,
+			wantStale:   []string{"user-2"},
+			wantFailed:  []string{"user-2"},
+		},
+		{
+			name:        "invalidated seats are listed again",
+			only:        []string{"user-1"},
+			invalidate:  true,
+			wantFetched: []string{"user-1", "user-2"},
+			wantLists:   3,
+		},
+		{
+			name:           "past the deadline everyone is carried over",
+			pastDeadline:   true,
+			wantLists:      4,
+			wantStale:      []string{"user-0", "user-1", "user-2"},
+			wantIncomplete: true,
+		},
+	}
+	for _, step := range steps {
+		if !t.Run(step.name, func(t *testing.T) {
+			src.fail, src.fetched = users(step.fail...), nil
+			if step.invalidate {
+				tn.seats = nil
+			}
+			deadline := time.Now().Add(time.Hour)
+			if step.pastDeadline {
+				deadline = time.Now().Add(-time.Second)
+			}
+			var only map[string]bool
+			if step.only != nil {
+				only = users(step.only...)
+			}
+
+			var summary audit.Summary
+			var err error
+			if step.hot {
+				err = refreshHot(context.Background(), tn, only, deadline, &summary)
+			} else {
+				err = collect(context.Background(), tn, only, deadline, &summary)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			slices.Sort(src.fetched)
+			if !slices.Equal(src.fetched, step.wantFetched) {
+				t.Errorf("fetched %v, want %v", src.fetched, step.wantFetched)
+			}
+			if src.lists != step.wantLists {
+				t.Errorf("seats listed %d times, want %d", src.lists, step.wantLists)
+			}
+			if got := trueKeys(tn.lastStale); !slices.Equal(got, step.wantStale) {
+				t.Errorf("stale %v, want %v", got, step.wantStale)
+			}
+			if got := trueKeys(tn.lastFailed); !slices.Equal(got, step.wantFailed) {
+				t.Errorf("failed %v, want %v", got, step.wantFailed)
+			}
+			if len(tn.lastGood) != 3 || len(tn.seats) != 3 {
+				t.Errorf("kept entries of %d users and %d seats, want 3 of each", len(tn.lastGood), len(tn.seats))
+			}
+			if summary.Incomplete != step.wantIncomplete {
+				t.Errorf("incomplete = %v, want %v", summary.Incomplete, step.wantIncomplete)
+			}
+			if snap := snapshots.Tenant(""); snap == nil || len(snap.Seats) != 3 {
+				t.Errorf("snapshot does not hold the 3 seats")
+			}
+		}) {
+			return
+		}
+	}
+}
+
+// trueKeys returns the keys set to true in m, sorted.
+func trueKeys(m map[string]bool) []string {
+	var keys []string
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		if m[k] {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
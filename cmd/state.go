@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/anomaly"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/config"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/github"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+	"go.uber.org/zap"
+)
+
+// stateFile is where tenant's latest cycle is kept across restarts:
+// conf.StateFile itself, or with the tenant's name inserted before the
+// extension.
+func stateFile(conf config.Config, tenant string) string {
+	if tenant == "" {
+		return conf.StateFile
+	}
+	ext := filepath.Ext(conf.StateFile)
+	return strings.TrimSuffix(conf.StateFile, ext) + "." + tenant + ext
+}
+
+// periodFile is where tenant's final snapshot of a closed billing month, as
+// "2006-01", is kept: its state file with the month inserted before the
+// extension.
+func periodFile(conf config.Config, tenant, month string) string {
+	path := stateFile(conf, tenant)
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + month + ext
+}
+
+// kafkaStateFile is where tenant's Kafka sink keeps the totals it last sent:
+// its state file with "kafka" inserted before the extension, or "" when
+// nothing is saved.
+func kafkaStateFile(conf config.Config, tenant string) string {
+	if conf.StateFile == "" {
+		return ""
+	}
+	path := stateFile(conf, tenant)
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".kafka" + ext
+}
+
+// tenantStateFile is where tenant keeps what it carries from one cycle to the
+// next: its state file with "tenant" inserted before the extension.
+func tenantStateFile(conf config.Config, tenant string) string {
+	path := stateFile(conf, tenant)
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".tenant" + ext
+}
+
+// savedTenant is what a tenant carries from one cycle to the next, saved so
+// that after a restart failed fetches still fall back to the previous values
+// and anomalies are scored against the baselines built up so far.
+type savedTenant struct {
+	SavedAt time.Time `json:"savedAt"`
+	// Labels are the usage label names the entries' label values follow.
+	Labels         []string                           `json:"labels"`
+	Seats          []github.CopilotSeat               `json:"seats"`
+	TotalSeats     int                                `json:"totalSeats"`
+	Incomplete     bool                               `json:"incomplete,omitempty"`
+	LastGood       map[string][]savedEntry            `json:"lastGood"`
+	LastStale      map[string]bool                    `json:"lastStale,omitempty"`
+	LastFailed     map[string]bool                    `json:"lastFailed,omitempty"`
+	LastBilling    []github.BillingUsageItem          `json:"lastBilling,omitempty"`
+	LastCommitters *github.AdvancedSecurityCommitters `json:"lastCommitters,omitempty"`
+	Anomalies      *anomaly.Detector                  `json:"anomalies"`
+	Scores         map[string]float64                 `json:"scores,omitempty"`
+	Anomalous      map[string]bool                    `json:"anomalous,omitempty"`
+}
+
+type savedEntry struct {
+	LabelValues []string         `json:"labelValues"`
+	Item        github.UsageItem `json:"item"`
+}
+
+// saveTenant writes what t carries to the next cycle to path.
+func saveTenant(path string, t *tenant) error {
+	saved := savedTenant{
+		SavedAt:        time.Now(),
+		Labels:         internal.UsageLabels(),
+		Seats:          t.seats,
+		TotalSeats:     t.totalSeats,
+		Incomplete:     t.incomplete,
+		LastGood:       make(map[string][]savedEntry, len(t.lastGood)),
+		LastStale:      t.lastStale,
+		LastFailed:     t.lastFailed,
+		LastBilling:    t.lastBilling,
+		LastCommitters: t.lastCommitters,
+		Anomalies:      t.anomalies,
+		Scores:         t.scores,
+		Anomalous:      t.anomalous,
+	}
+	for login, entries := range t.lastGood {
+		saved.LastGood[login] = make([]savedEntry, len(entries))
+		for i, e := range entries {
+			saved.LastGood[login][i] = savedEntry{LabelValues: e.labelValues, Item: e.item}
+		}
+	}
+	return writeFile(path, func(enc *json.Encoder) error {
+		return enc.Encode(saved)
+	})
+}
+
+// restoreTenant loads into t what a previous run saved with saveTenant to
+// path. Entries are left out when the usage labels have changed since or they
+// are from an earlier billing month, and the anomaly baselines are restored
+// either way.
+func restoreTenant(path string, t *tenant) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	saved := savedTenant{Anomalies: t.anomalies}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("reading tenant state: %w", err)
+	}
+	t.anomalous, t.scores = saved.Anomalous, saved.Scores
+
+	cal := calendar(t.conf)
+	if !slices.Equal(saved.Labels, internal.UsageLabels()) {
+		return fmt.Errorf("usage labels changed from %v, not restoring previous entries", saved.Labels)
+	}
+	if !cal.MonthOf(saved.SavedAt).Start.Equal(cal.MonthOf(time.Now()).Start) {
+		return fmt.Errorf("saved in an earlier billing month, not restoring previous entries")
+	}
+	t.seats, t.totalSeats, t.incomplete = saved.Seats, saved.TotalSeats, saved.Incomplete
+	t.lastGood = make(map[string][]metricEntry, len(saved.LastGood))
+	for login, entries := range saved.LastGood {
+		t.lastGood[login] = make([]metricEntry, len(entries))
+		for i, e := range entries {
+			t.lastGood[login][i] = metricEntry{labelValues: e.LabelValues, item: e.Item}
+		}
+	}
+	t.lastStale, t.lastFailed = saved.LastStale, saved.LastFailed
+	if t.lastStale == nil {
+		t.lastStale = map[string]bool{}
+	}
+	t.lastBilling, t.lastCommitters = saved.LastBilling, saved.LastCommitters
+	return nil
+}
+
+// saveState writes snap followed by the series of set to path.
+func saveState(path string, snap *snapshot.Snapshot, set *internal.MetricSet) error {
+	return writeFile(path, func(enc *json.Encoder) error {
+		if err := enc.Encode(snap); err != nil {
+			return err
+		}
+		return set.Encode(enc)
+	})
+}
+
+// savePeriod keeps snap, the last one of a billing month, for /api/v1/diff.
+func savePeriod(path string, snap *snapshot.Snapshot) error {
+	return writeFile(path, func(enc *json.Encoder) error {
+		return enc.Encode(snap)
+	})
+}
+
+// writeFile writes path with write. The file is only replaced once complete,
+// so a crash mid-write keeps the previous one.
+func writeFile(path string, write func(enc *json.Encoder) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	if err := write(json.NewEncoder(w)); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// restoreState publishes each tenant's cycle saved by a previous run, so
+// scrapes and the API serve the last known values after a restart instead of
+// nothing until the first cycle completes. The saved cycle keeps its
+// collection time, so its data age and the staleness guard stay truthful.
+func restoreState(conf config.Config) {
+	names := conf.TenantNames()
+	if len(names) == 0 {
+		names = []string{""}
+	}
+	for _, name := range names {
+		path := stateFile(conf, name)
+		log := logger.With(zap.String("path", path))
+		if name != "" {
+			log = log.With(zap.String("tenant", name))
+		}
+		snap, skipped, err := loadState(path, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Info("no saved state to restore")
+			continue
+		}
+		if err != nil {
+			log.Warn("failed to restore saved state", zap.Error(err))
+			continue
+		}
+		log.Info("restored state from previous run",
+			zap.Time("collectedAt", snap.CollectedAt),
+			zap.Int("skippedSeries", skipped),
+		)
+	}
+}
+
+func loadState(path, tenant string) (*snapshot.Snapshot, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	var snap snapshot.Snapshot
+	if err := dec.Decode(&snap); err != nil {
+		return nil, 0, fmt.Errorf("reading state file: %w", err)
+	}
+	if snap.Tenant != tenant {
+		return nil, 0, fmt.Errorf("state file belongs to tenant %q", snap.Tenant)
+	}
+	set, skipped, err := internal.DecodeMetricSet(dec, tenant, snap.CollectedAt)
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading state file: %w", err)
+	}
+	if err := internal.Publish(set); err != nil {
+		return nil, 0, fmt.Errorf("publishing saved metrics: %w", err)
+	}
+	snapshots.Set(&snap)
+	return &snap, skipped, nil
+}
+
+// periodHistory serves /api/v1/diff the latest snapshot of each tenant for
+// the billing month in progress and the saved ones of closed months.
+type periodHistory struct {
+	reloader *config.Reloader
+}
+
+func (h periodHistory) Month(month string) (*snapshot.Snapshot, error) {
+	conf := h.reloader.Current()
+	names := conf.TenantNames()
+	if len(names) == 0 {
+		names = []string{""}
+	}
+	snaps := make(map[string]*snapshot.Snapshot, len(names))
+	for _, name := range names {
+		if snap := snapshots.Tenant(name); snap != nil && calendar(conf).MonthOf(snap.CollectedAt).Start.Format("2006-01") == month {
+			snaps[name] = snap
+			continue
+		}
+		if conf.StateFile == "" {
+			continue
+		}
+		f, err := os.Open(periodFile(conf, name, month))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var snap snapshot.Snapshot
+		err = json.NewDecoder(bufio.NewReader(f)).Decode(&snap)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot of %s: %w", month, err)
+		}
+		snaps[name] = &snap
+	}
+	if len(snaps) == 0 {
+		return nil, nil
+	}
+	return snapshot.Merge(snaps), nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"reflect"
+	"time"
+
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/anomaly"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/config"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/enrich"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/github"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/sink"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/source"
+	"go.uber.org/zap"
+)
+
+// tenant is one enterprise collected by the worker, with everything built
+// from its configuration and the state carried between its cycles. Only
+// touched by the worker goroutine.
+type tenant struct {
+	// name is "" in a single-tenant deployment.
+	name   string
+	logger *zap.Logger
+
+	conf        config.Config
+	client      *github.Client
+	src         source.UsageSource
+	pipeline    *enrich.Pipeline
+	sinks       *sink.Fanout
+	preflighted bool
+
+	// seats caches the seats collected in the most recent cycle, and
+	// totalSeats and incomplete what it found about them, for hot refreshes
+	// and partial cycles, which do not list seats again. A webhook about
+	// seat changes invalidates the cache by setting it to nil.
+	seats      []github.CopilotSeat
+	totalSeats int
+	incomplete bool
+	// lastGood holds each user's entries from the most recent cycle in which
+	// they were fetched successfully, so a failed fetch republishes the
+	// previous values instead of dropping the user's series.
+	lastGood map[string][]metricEntry
+	// lastStale holds the users whose lastGood entries were republished after
+	// a failed fetch in the most recent cycle. Partial cycles refetch them.
+	lastStale map[string]bool
+	// lastFailed holds the users whose fetch failed in the most recent cycle.
+	lastFailed map[string]bool
+	// lastBilling and lastCommitters hold the most recent enterprise-level
+	// billing data fetched successfully, republished when a later fetch
+	// fails.
+	lastBilling    []github.BillingUsageItem
+	lastCommitters *github.AdvancedSecurityCommitters
+	// anomalies holds each user's daily spend baseline across cycles, and
+	// scores and anomalous each user's score and the users it flagged in
+	// the most recent cycle.
+	anomalies *anomaly.Detector
+	scores    map[string]float64
+	anomalous map[string]bool
+}
+
+// newTenants returns the tenants configured in conf, or a single unnamed one
+// collecting the github settings.
+func newTenants(ctx context.Context, conf config.Config) []*tenant {
+	tenants := conf.Tenants
+	if len(tenants) == 0 {
+		tenants = []config.Tenant{{}}
+	}
+	out := make([]*tenant, len(tenants))
+	for i, t := range tenants {
+		out[i] = &tenant{
+			name:      t.Name,
+			logger:    logger,
+			lastGood:  map[string][]metricEntry{},
+			lastStale: map[string]bool{},
+			anomalies: anomaly.New(conf.Anomaly.Window, conf.Anomaly.MinDays),
+		}
+		if t.Name != "" {
+			out[i].logger = logger.With(zap.String("tenant", t.Name))
+		}
+		out[i].configure(ctx, conf.ForTenant(t))
+		if conf.StateFile != "" {
+			out[i].restore()
+		}
+	}
+	return out
+}
+
+// restore picks up what t carried between cycles in a previous run.
+func (t *tenant) restore() {
+	path := tenantStateFile(t.conf, t.name)
+	log := t.logger.With(zap.String("path", path))
+	err := restoreTenant(path, t)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		log.Info("no saved tenant state to restore")
+	case err != nil:
+		log.Warn("could not fully restore saved tenant state", zap.Error(err))
+	default:
+		log.Info("restored tenant state from previous run",
+			zap.Int("seats", len(t.seats)),
+			zap.Int("users", len(t.lastGood)),
+		)
+	}
+}
+
+// reconfigure applies a reloaded configuration to every tenant. Tenant names
+// never change on reload, so they still line up with conf.Tenants.
+func reconfigure(ctx context.Context, tenants []*tenant, conf config.Config) {
+	for i, t := range tenants {
+		tconf := conf
+		if len(conf.Tenants) > 0 {
+			tconf = conf.ForTenant(conf.Tenants[i])
+		}
+		t.configure(ctx, tconf)
+	}
+}
+
+// configure applies conf to t, rebuilding only the client, the source, the
+// enrichment stages and the sinks whose settings changed, so a reload keeps
+// their connections, caches and state otherwise. Everything is built on the
+// first call.
+func (t *tenant) configure(ctx context.Context, conf config.Config) {
+	old, first := t.conf, t.client == nil
+	t.conf = conf
+	t.anomalies.Window, t.anomalies.MinDays = conf.Anomaly.Window, conf.Anomaly.MinDays
+	t.anomalies.Calendar = calendar(conf)
+
+	clientChanged := first || !reflect.DeepEqual(old.Github, conf.Github)
+	if clientChanged {
+		t.client = newClient(conf, t.name)
+		t.preflighted = false
+	}
+	if clientChanged || !reflect.DeepEqual(
+		[]any{old.Identity, old.Org, old.Bots, old.LDAP, old.Entra},
+		[]any{conf.Identity, conf.Org, conf.Bots, conf.LDAP, conf.Entra},
+	) {
+		t.pipeline = newPipeline(conf, t.client)
+	}
+	if clientChanged || !reflect.DeepEqual(old.Source, conf.Source) {
+		if src, err := newSource(conf, t.client); err != nil {
+			t.logger.Error("invalid collection source in reloaded configuration, keeping current", zap.Error(err))
+		} else {
+			t.src = src
+			t.preflighted = false
+		}
+	}
+	if first || !reflect.DeepEqual(old.Sinks, conf.Sinks) || old.Billing.Timezone != conf.Billing.Timezone ||
+		old.StateFile != conf.StateFile {
+		if t.sinks != nil {
+			if err := t.sinks.Close(); err != nil {
+				t.logger.Warn("failed to close sinks", zap.Error(err))
+			}
+		}
+		t.sinks = newSinks(ctx, conf, t.name)
+	}
+}
+
+// hotUsers returns the users a hot refresh recollects: the top spenders of
+// t's latest snapshot and, if configured, those last flagged as anomalous.
+// It returns nil until t has completed a cycle in this process, as there are
+// no seats to republish before, after a reload until the next full cycle has
+// preflighted the client, and once the billing month of the latest snapshot
+// has ended, since everyone else's values would be last month's.
+func (t *tenant) hotUsers() map[string]bool {
+	snap := snapshots.Tenant(t.name)
+	if snap == nil || t.seats == nil || !t.preflighted {
+		return nil
+	}
+	if cal := calendar(t.conf); !cal.MonthOf(snap.CollectedAt).Start.Equal(cal.MonthOf(time.Now()).Start) {
+		return nil
+	}
+	// Ranking by gross amount catches heavy users before they exceed their
+	// included quota.
+	top, err := snap.Top(t.conf.HotRefresh.TopN, "gross_amount", "user")
+	if err != nil {
+		return nil
+	}
+	users := make(map[string]bool, len(top)+len(t.anomalous))
+	for _, g := range top {
+		users[g.Key] = true
+	}
+	if t.conf.HotRefresh.Anomalous {
+		for login := range t.anomalous {
+			users[login] = true
+		}
+	}
+	return users
+}
+
+func (t *tenant) close() {
+	if err := t.sinks.Close(); err != nil {
+		t.logger.Warn("failed to close sinks", zap.Error(err))
+	}
+}
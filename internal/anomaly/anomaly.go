@@ -0,0 +1,140 @@
+// Package anomaly scores each user's spend today against their own recent
+// days, to catch leaked tokens or runaway agent workflows before the monthly
+// bill does.
+package anomaly
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/billing"
+)
+
+// minSpread is the smallest standard deviation, in USD, a score is divided
+// by. Without it a user who spent exactly the same every day would score
+// infinitely on the first cent of difference.
+const minSpread = 1.0
+
+// Detector keeps a rolling window of each user's completed daily spend,
+// derived from the month-to-date totals observed every cycle. The zero value
+// is not usable; set Window and MinDays and call New.
+type Detector struct {
+	// Window is how many completed days form a user's baseline.
+	Window int
+	// MinDays is how many completed days a user needs before being scored.
+	MinDays int
+	// Calendar decides where days and billing months start.
+	Calendar billing.Calendar
+
+	users map[string]*history
+}
+
+type history struct {
+	day      time.Time // start of the day being observed
+	dayStart float64   // month-to-date total when the day began
+	last     float64   // latest month-to-date total
+	days     []float64 // completed days' spend, oldest first
+	partial  bool      // whether the day was first observed part way through
+}
+
+func New(window, minDays int) *Detector {
+	return &Detector{Window: window, MinDays: minDays, users: make(map[string]*history)}
+}
+
+// Observe records user's month-to-date spend at at and returns how many
+// standard deviations today's spend so far lies above their baseline. ok is
+// false until the user has MinDays completed days.
+func (d *Detector) Observe(user string, monthToDate float64, at time.Time) (score float64, ok bool) {
+	day := d.Calendar.DayOf(at)
+	h, seen := d.users[user]
+	if !seen {
+		// Spend earlier today is unknown, so the first day only starts the
+		// baseline.
+		h = &history{day: day, dayStart: monthToDate, partial: true}
+		d.users[user] = h
+	}
+	if day.After(h.day) {
+		if !h.partial {
+			h.days = append(h.days, h.last-h.dayStart)
+		}
+		h.partial = false
+		if len(h.days) > d.Window {
+			h.days = h.days[len(h.days)-d.Window:]
+		}
+		h.dayStart = h.last
+		// Month-to-date totals start over on the first of the month.
+		if !d.Calendar.MonthOf(day).Start.Equal(d.Calendar.MonthOf(h.day).Start) {
+			h.dayStart = 0
+		}
+		h.day = day
+	}
+	h.last = monthToDate
+
+	if len(h.days) < d.MinDays {
+		return 0, false
+	}
+	mean, std := meanStd(h.days)
+	return (monthToDate - h.dayStart - mean) / max(std, minSpread), true
+}
+
+// Prune forgets users last observed more than Window days before now, such as
+// those whose seat was removed.
+func (d *Detector) Prune(now time.Time) {
+	cutoff := d.Calendar.DayOf(now).AddDate(0, 0, -d.Window)
+	for user, h := range d.users {
+		if h.day.Before(cutoff) {
+			delete(d.users, user)
+		}
+	}
+}
+
+// savedHistory is the JSON form of a history.
+type savedHistory struct {
+	Day      time.Time `json:"day"`
+	DayStart float64   `json:"dayStart"`
+	Last     float64   `json:"last"`
+	Days     []float64 `json:"days,omitempty"`
+	Partial  bool      `json:"partial,omitempty"`
+}
+
+// MarshalJSON encodes every user's history, so baselines can outlive the
+// process. The settings are left out, as they come from the configuration.
+func (d *Detector) MarshalJSON() ([]byte, error) {
+	saved := make(map[string]savedHistory, len(d.users))
+	for user, h := range d.users {
+		saved[user] = savedHistory{Day: h.day, DayStart: h.dayStart, Last: h.last, Days: h.days, Partial: h.partial}
+	}
+	return json.Marshal(saved)
+}
+
+// UnmarshalJSON replaces the users' histories with those encoded by
+// MarshalJSON, keeping d's settings. Histories longer than Window are cut to
+// its most recent days.
+func (d *Detector) UnmarshalJSON(data []byte) error {
+	var saved map[string]savedHistory
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	d.users = make(map[string]*history, len(saved))
+	for user, h := range saved {
+		if len(h.Days) > d.Window {
+			h.Days = h.Days[len(h.Days)-d.Window:]
+		}
+		d.users[user] = &history{day: h.Day, dayStart: h.DayStart, last: h.Last, days: h.Days, partial: h.Partial}
+	}
+	return nil
+}
+
+func meanStd(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
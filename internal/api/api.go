@@ -0,0 +1,113 @@
+// Package api serves JSON views of the collection snapshots for people who
+// want answers rather than time series.
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+)
+
+const defaultTopN = 25
+const maxTopN = 1000
+
+// History looks up the snapshot of a billing month given as "2006-01": the
+// latest one for the month in progress, or the last one of a closed month. It
+// returns nil if there is none.
+type History interface {
+	Month(month string) (*snapshot.Snapshot, error)
+}
+
+type API struct {
+	store   *snapshot.Store
+	history History
+}
+
+func New(store *snapshot.Store, history History) *API {
+	return &API{store: store, history: history}
+}
+
+// Register mounts the endpoints under /api/v1 on router.
+func (a *API) Register(router fiber.Router) {
+	v1 := router.Group("/api/v1")
+	v1.Get("/top", a.top)
+	v1.Get("/diff", a.diff)
+}
+
+type topResponse struct {
+	Enterprise  string           `json:"enterprise"`
+	CollectedAt time.Time        `json:"collectedAt"`
+	By          string           `json:"by"`
+	GroupBy     string           `json:"groupBy"`
+	Items       []snapshot.Group `json:"items"`
+}
+
+// top answers GET /api/v1/top?n=25&by=net_amount&group_by=user with the n
+// biggest spenders of the current month.
+func (a *API) top(c *fiber.Ctx) error {
+	n := c.QueryInt("n", defaultTopN)
+	if n <= 0 || n > maxTopN {
+		return errorJSON(c, fiber.StatusBadRequest, "n must be between 1 and 1000")
+	}
+	by := c.Query("by", "net_amount")
+	groupBy := c.Query("group_by", "user")
+
+	snap := a.store.Latest()
+	if snap == nil {
+		return errorJSON(c, fiber.StatusServiceUnavailable, "no collection has completed yet")
+	}
+	items, err := snap.Top(n, by, groupBy)
+	if err != nil {
+		return errorJSON(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(topResponse{
+		Enterprise:  snap.Enterprise,
+		CollectedAt: snap.CollectedAt,
+		By:          by,
+		GroupBy:     groupBy,
+		Items:       items,
+	})
+}
+
+type diffResponse struct {
+	From            string    `json:"from"`
+	To              string    `json:"to"`
+	FromCollectedAt time.Time `json:"fromCollectedAt"`
+	ToCollectedAt   time.Time `json:"toCollectedAt"`
+	snapshot.Diff
+}
+
+// diff answers GET /api/v1/diff?from=2024-05&to=2024-06 with how each user's
+// and model's spend changed between the two billing months, and which seat
+// holders were added or removed.
+func (a *API) diff(c *fiber.Ctx) error {
+	months := make([]*snapshot.Snapshot, 2)
+	for i, param := range []string{"from", "to"} {
+		month := c.Query(param)
+		if _, err := time.Parse("2006-01", month); err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, param+" must be a month such as 2024-05")
+		}
+		snap, err := a.history.Month(month)
+		if err != nil {
+			return errorJSON(c, fiber.StatusInternalServerError, err.Error())
+		}
+		if snap == nil {
+			return errorJSON(c, fiber.StatusNotFound, "no snapshot kept for "+month)
+		}
+		months[i] = snap
+	}
+
+	return c.JSON(diffResponse{
+		From:            c.Query("from"),
+		To:              c.Query("to"),
+		FromCollectedAt: months[0].CollectedAt,
+		ToCollectedAt:   months[1].CollectedAt,
+		Diff:            snapshot.Compare(months[0], months[1]),
+	})
+}
+
+func errorJSON(c *fiber.Ctx, status int, message string) error {
+	return c.Status(status).JSON(fiber.Map{"error": message})
+}
@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Summary is the end-of-cycle record describing how complete a collection
+// run was. It is what auditors use to confirm that the numbers feeding
+// chargeback were collected for every seat holder.
+type Summary struct {
+	// Cycle is the ID shared by every log line of the cycle.
+	Cycle      string `json:"cycle"`
+	Tenant     string `json:"tenant,omitempty"`
+	Enterprise string `json:"enterprise"`
+	Partial    bool   `json:"partial,omitempty"`
+	// Incomplete is set when the cycle hit its deadline before fetching
+	// every seat holder.
+	Incomplete        bool      `json:"incomplete,omitempty"`
+	StartedAt         time.Time `json:"startedAt"`
+	FinishedAt        time.Time `json:"finishedAt"`
+	DurationSeconds   float64   `json:"durationSeconds"`
+	UsersAttempted    int       `json:"usersAttempted"`
+	UsersSucceeded    int       `json:"usersSucceeded"`
+	UsersFailed       int       `json:"usersFailed"`
+	UsersRetained     int       `json:"usersRetained"`
+	UsersReused       int       `json:"usersReused,omitempty"`
+	UsersGone         int       `json:"usersGone,omitempty"`
+	GrossAmount       float64   `json:"grossAmount"`
+	NetAmount         float64   `json:"netAmount"`
+	APICalls          int64     `json:"apiCalls"`
+	RateLimitConsumed int       `json:"rateLimitConsumed"`
+	Error             string    `json:"error,omitempty"`
+}
+
+func (s *Summary) Finish(at time.Time, err error) {
+	s.FinishedAt = at
+	s.DurationSeconds = at.Sub(s.StartedAt).Seconds()
+	if err != nil {
+		s.Error = err.Error()
+	}
+}
+
+func (s Summary) Fields() []zap.Field {
+	fields := []zap.Field{zap.String("cycle", s.Cycle)}
+	if s.Tenant != "" {
+		fields = append(fields, zap.String("tenant", s.Tenant))
+	}
+	fields = append(fields,
+		zap.String("enterprise", s.Enterprise),
+		zap.Bool("partial", s.Partial),
+		zap.Bool("incomplete", s.Incomplete),
+		zap.Time("startedAt", s.StartedAt),
+		zap.Time("finishedAt", s.FinishedAt),
+		zap.Float64("durationSeconds", s.DurationSeconds),
+		zap.Int("usersAttempted", s.UsersAttempted),
+		zap.Int("usersSucceeded", s.UsersSucceeded),
+		zap.Int("usersFailed", s.UsersFailed),
+		zap.Int("usersRetained", s.UsersRetained),
+		zap.Int("usersReused", s.UsersReused),
+		zap.Int("usersGone", s.UsersGone),
+		zap.Float64("grossAmount", s.GrossAmount),
+		zap.Float64("netAmount", s.NetAmount),
+		zap.Int64("apiCalls", s.APICalls),
+		zap.Int("rateLimitConsumed", s.RateLimitConsumed),
+	)
+	if s.Error != "" {
+		fields = append(fields, zap.String("error", s.Error))
+	}
+	return fields
+}
+
+// FileSink appends each summary as a single JSON line to a file, syncing
+// after every write so records survive a crash or pod eviction.
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+func (f *FileSink) Write(s Summary) error {
+	line, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encoding audit summary: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening audit file %s: %w", f.path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing audit file %s: %w", f.path, err)
+	}
+	return file.Sync()
+}
@@ -0,0 +1,16 @@
+package billing
+
+// LicensePrices holds the monthly list price of a seat for each Copilot plan.
+type LicensePrices struct {
+	Business   float64
+	Enterprise float64
+}
+
+// ForPlan returns the monthly price of a seat with the given plan_type.
+// Unknown plans are priced as Business, like Quotas.ForPlan.
+func (p LicensePrices) ForPlan(plan string) float64 {
+	if plan == "enterprise" {
+		return p.Enterprise
+	}
+	return p.Business
+}
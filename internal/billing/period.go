@@ -0,0 +1,83 @@
+package billing
+
+import "time"
+
+// Period is a billing period covering [Start, End).
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Calendar computes billing periods in the timezone GitHub bills an
+// enterprise in, so months start when GitHub's do rather than at midnight
+// UTC. The zero value bills in UTC.
+type Calendar struct {
+	Location *time.Location
+}
+
+func (c Calendar) location() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
+
+// MonthOf returns the calendar-month billing period containing t. Start and
+// End are in the calendar's location.
+func (c Calendar) MonthOf(t time.Time) Period {
+	t = t.In(c.location())
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	return Period{Start: start, End: start.AddDate(0, 1, 0)}
+}
+
+// DayOf returns the start of the billing day containing t.
+func (c Calendar) DayOf(t time.Time) time.Time {
+	t = t.In(c.location())
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// ElapsedFraction returns how much of the period has passed at now, between 0
+// and 1. When weekdayAware is set only Monday to Friday count, so weekend
+// days neither advance the fraction nor dilute the forecast.
+func (p Period) ElapsedFraction(now time.Time, weekdayAware bool) float64 {
+	if !now.After(p.Start) {
+		return 0
+	}
+	if !now.Before(p.End) {
+		return 1
+	}
+	if !weekdayAware {
+		return now.Sub(p.Start).Seconds() / p.End.Sub(p.Start).Seconds()
+	}
+	total := weekdayDuration(p.Start, p.End)
+	if total == 0 {
+		return 1
+	}
+	return weekdayDuration(p.Start, now).Seconds() / total.Seconds()
+}
+
+// Forecast extrapolates a month-to-date amount linearly to the end of the
+// period. Before any (weekday) time has elapsed the amount itself is returned.
+func Forecast(amount float64, p Period, now time.Time, weekdayAware bool) float64 {
+	f := p.ElapsedFraction(now, weekdayAware)
+	if f <= 0 {
+		return amount
+	}
+	return amount / f
+}
+
+// weekdayDuration sums the Monday-to-Friday time between from and to.
+func weekdayDuration(from, to time.Time) time.Duration {
+	var d time.Duration
+	for day := from; day.Before(to); {
+		next := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location())
+		if next.After(to) {
+			next = to
+		}
+		if wd := day.Weekday(); wd != time.Saturday && wd != time.Sunday {
+			d += next.Sub(day)
+		}
+		day = next
+	}
+	return d
+}
@@ -0,0 +1,37 @@
+package billing
+
+import "go.dfds.cloud/copilot-premium-usage-exporter/internal/github"
+
+// ProductUsage is a month's usage of one SKU by one organization.
+type ProductUsage struct {
+	Organization string
+	SKU          string
+	UnitType     string
+	Quantity     float64
+	GrossAmount  float64
+	NetAmount    float64
+}
+
+// SumByOrganization folds the daily, per-repository items of product into one
+// total per organization and SKU, in the order they first appear.
+func SumByOrganization(items []github.BillingUsageItem, product string) []ProductUsage {
+	type key struct{ org, sku, unit string }
+	index := make(map[key]int)
+	var usage []ProductUsage
+	for _, item := range items {
+		if item.Product != product {
+			continue
+		}
+		k := key{item.OrganizationName, item.SKU, item.UnitType}
+		i, ok := index[k]
+		if !ok {
+			i = len(usage)
+			index[k] = i
+			usage = append(usage, ProductUsage{Organization: k.org, SKU: k.sku, UnitType: k.unit})
+		}
+		usage[i].Quantity += item.Quantity
+		usage[i].GrossAmount += item.GrossAmount
+		usage[i].NetAmount += item.NetAmount
+	}
+	return usage
+}
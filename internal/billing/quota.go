@@ -0,0 +1,48 @@
+package billing
+
+import "go.dfds.cloud/copilot-premium-usage-exporter/internal/github"
+
+// Quotas holds the monthly number of premium requests included per seat for
+// each Copilot plan.
+type Quotas struct {
+	Business   float64
+	Enterprise float64
+}
+
+// ForPlan returns the included requests for a seat's plan_type. Unknown plans
+// get the Business allowance, the smaller of the two.
+func (q Quotas) ForPlan(plan string) float64 {
+	if plan == "enterprise" {
+		return q.Enterprise
+	}
+	return q.Business
+}
+
+// QuotaUsage splits a user's month-to-date premium requests into what the
+// plan's included quota covered and the billable overage.
+type QuotaUsage struct {
+	Quota           float64
+	IncludedUsed    float64
+	Utilization     float64
+	OverageRequests float64
+	OverageCost     float64
+}
+
+// Breakdown derives quota usage from a user's usage items. Quantities GitHub
+// discounted are the included requests; the net quantity and amount are the
+// overage. Utilization is gross requests over quota and exceeds 1 once the
+// user is into overage.
+func Breakdown(items []github.UsageItem, quota float64) QuotaUsage {
+	u := QuotaUsage{Quota: quota}
+	var gross float64
+	for _, item := range items {
+		gross += item.GrossQuantity
+		u.IncludedUsed += item.DiscountQuantity
+		u.OverageRequests += item.NetQuantity
+		u.OverageCost += item.NetAmount
+	}
+	if quota > 0 {
+		u.Utilization = gross / quota
+	}
+	return u
+}
@@ -1,29 +1,593 @@
 package config
 
-import "github.com/kelseyhightower/envconfig"
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+)
 
 type Config struct {
+	ConfigFile     string `json:"-"`
+	ListenAddr     string `json:"listenAddr"`
 	LogLevel       string `json:"logLevel"`
 	LogDebug       bool   `json:"logDebug"`
 	WorkerInterval int    `json:"workerInterval"`
-	Github         struct {
+	WorkerJitter   int    `json:"workerJitter"`
+	// CycleDeadline is how many seconds a cycle may run before it is cut
+	// short and its partial results published. Defaults to WorkerInterval.
+	CycleDeadline int    `json:"cycleDeadline"`
+	Schedule      string `json:"schedule"`
+	AuditFile     string `json:"auditFile"`
+	// StateFile is where the latest cycle is saved so a restart serves it
+	// until the first new cycle completes. With tenants, each tenant's name
+	// is inserted before the extension. The Kafka sink keeps the totals it
+	// last sent next to it, with "kafka" inserted. Nothing is saved when
+	// empty.
+	StateFile string `json:"stateFile"`
+	Admin     struct {
+		ListenAddr string `json:"listenAddr"`
+		Pprof      bool   `json:"pprof"`
 		Token      string `json:"token"`
-		Enterprise string `json:"enterprise"`
+		// CaptureResponses is how many premium usage responses to keep for
+		// /debug/github/responses, with logins and other identifying body
+		// fields redacted; 0 disables capturing.
+		CaptureResponses int `json:"captureResponses"`
+	} `json:"admin"`
+	Github struct {
+		Token      string   `json:"token"`
+		Tokens     []string `json:"tokens"`
+		Enterprise string   `json:"enterprise"`
+		BaseURL    string   `json:"baseUrl"`
+		// Subdomain selects a GHE.com data residency instance, whose API is
+		// served from https://api.SUBDOMAIN.ghe.com. BaseURL takes precedence.
+		Subdomain string `json:"subdomain"`
+		PageSize  int    `json:"pageSize"`
+		Transport struct {
+			MaxIdleConns        int  `json:"maxIdleConns"`
+			MaxIdleConnsPerHost int  `json:"maxIdleConnsPerHost"`
+			IdleConnTimeout     int  `json:"idleConnTimeout"`
+			DisableHTTP2        bool `json:"disableHttp2"`
+		} `json:"transport"`
+		RateLimit struct {
+			RequestsPerSecond float64 `json:"requestsPerSecond"`
+			Burst             int     `json:"burst"`
+		} `json:"rateLimit"`
 	} `json:"github"`
+	// Tenants collects several enterprises, e.g. one on github.com and one on
+	// GHE.com, in one deployment. They can only be set in the config file.
+	// When empty, github describes the only enterprise.
+	Tenants []Tenant `json:"tenants" ignored:"true"`
+	Source  struct {
+		// Kind is "rest" for the GitHub REST API or "replay" to serve the
+		// recording in ReplayFile.
+		Kind       string `json:"kind"`
+		ReplayFile string `json:"replayFile"`
+	} `json:"source"`
+	Preflight struct {
+		FailFast bool `json:"failFast"`
+	} `json:"preflight"`
+	Quota struct {
+		Business   float64 `json:"business"`
+		Enterprise float64 `json:"enterprise"`
+	} `json:"quota"`
+	Billing struct {
+		Actions          bool `json:"actions"`
+		Packages         bool `json:"packages"`
+		AdvancedSecurity bool `json:"advancedSecurity"`
+		// Timezone is the IANA name of the timezone GitHub bills the
+		// enterprise in, which decides when a billing month starts.
+		Timezone string `json:"timezone"`
+	} `json:"billing"`
+	Forecast struct {
+		WeekdayAware bool `json:"weekdayAware"`
+	} `json:"forecast"`
+	// HotRefresh recollects the biggest spenders between full cycles, so
+	// runaway spend shows up sooner without sweeping every seat more often.
+	HotRefresh struct {
+		// Interval is how many seconds after a cycle a hot refresh runs,
+		// unless a full cycle is due first; 0 disables hot refreshes.
+		Interval int `json:"interval"`
+		// TopN is how many of the top spenders by gross amount are
+		// recollected.
+		TopN int `json:"topN"`
+		// Anomalous also recollects users flagged by anomaly scoring.
+		Anomalous bool `json:"anomalous"`
+	} `json:"hotRefresh"`
+	// Anomaly scores each user's gross spend today against their own daily
+	// spend over the last Window days.
+	Anomaly struct {
+		Enabled bool `json:"enabled"`
+		// Window is how many completed days form a user's baseline.
+		Window int `json:"window"`
+		// MinDays is how many completed days a user needs before being
+		// scored.
+		MinDays int `json:"minDays"`
+		// Threshold is the score at and above which a user is flagged.
+		Threshold float64 `json:"threshold"`
+	} `json:"anomaly"`
+	License struct {
+		Business   float64 `json:"business"`
+		Enterprise float64 `json:"enterprise"`
+	} `json:"license"`
+	Chargeback struct {
+		// Output is a storage location as accepted by storage.Open. No
+		// statements are written when it is empty.
+		Output            string            `json:"output"`
+		Formats           []string          `json:"formats"`
+		CostCenters       map[string]string `json:"costCenters"`
+		DefaultCostCenter string            `json:"defaultCostCenter"`
+	} `json:"chargeback"`
+	Sinks struct {
+		BigQuery struct {
+			Project string `json:"project"`
+			Dataset string `json:"dataset"`
+			Table   string `json:"table"`
+		} `json:"bigquery"`
+		Snowflake struct {
+			DSN   string `json:"dsn"`
+			Table string `json:"table"`
+		} `json:"snowflake"`
+		Kafka struct {
+			Brokers       []string `json:"brokers"`
+			Topic         string   `json:"topic"`
+			ChangedOnly   bool     `json:"changedOnly"`
+			TLS           bool     `json:"tls"`
+			SASLMechanism string   `json:"saslMechanism"`
+			Username      string   `json:"username"`
+			Password      string   `json:"password"`
+		} `json:"kafka"`
+		StatsD struct {
+			Address string   `json:"address"`
+			Tags    []string `json:"tags"`
+		} `json:"statsd"`
+		Datadog struct {
+			APIKey     string            `json:"apiKey"`
+			Site       string            `json:"site"`
+			Tags       []string          `json:"tags"`
+			TagMapping map[string]string `json:"tagMapping"`
+		} `json:"datadog"`
+		Archive struct {
+			// Output is a storage location as accepted by storage.Open.
+			Output string `json:"output"`
+			Format string `json:"format"`
+		} `json:"archive"`
+	} `json:"sinks"`
+	Bots struct {
+		// Mode is "label" to add an account_type label, "exclude" to leave
+		// bots out of collection entirely, or empty to treat them as users.
+		Mode string `json:"mode"`
+		// Patterns are regular expressions matched against logins to catch
+		// machine users, which GitHub reports as ordinary users.
+		Patterns []string `json:"patterns"`
+	} `json:"bots"`
+	Identity struct {
+		Email               bool   `json:"email"`
+		EmployeeIDAttribute string `json:"employeeIdAttribute"`
+		RefreshInterval     int    `json:"refreshInterval"`
+	} `json:"identity"`
+	Org struct {
+		Label     bool     `json:"label"`
+		Strategy  string   `json:"strategy"`
+		Preferred []string `json:"preferred"`
+	} `json:"org"`
+	LDAP struct {
+		URL                 string `json:"url"`
+		BindDN              string `json:"bindDn"`
+		BindPassword        string `json:"bindPassword"`
+		BaseDN              string `json:"baseDn"`
+		Filter              string `json:"filter"`
+		DepartmentAttribute string `json:"departmentAttribute"`
+		ManagerAttribute    string `json:"managerAttribute"`
+		ManagerLabel        bool   `json:"managerLabel"`
+		RefreshInterval     int    `json:"refreshInterval"`
+	} `json:"ldap"`
+	Entra struct {
+		TenantID           string   `json:"tenantId"`
+		ClientID           string   `json:"clientId"`
+		ClientSecret       string   `json:"clientSecret"`
+		FederatedTokenFile string   `json:"federatedTokenFile"`
+		Groups             []string `json:"groups"`
+		RefreshInterval    int      `json:"refreshInterval"`
+	} `json:"entra"`
+	Webhook struct {
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+	} `json:"webhook"`
+	Metrics struct {
+		Namespace          string            `json:"namespace"`
+		ExtraLabels        map[string]string `json:"extraLabels"`
+		AssigningTeamLabel bool              `json:"assigningTeamLabel"`
+		CostBuckets        []float64         `json:"costBuckets"`
+		OpenMetrics        bool              `json:"openMetrics"`
+		// Labels, when set, is the whole label set of the per-user usage
+		// families besides enterprise, in order, replacing the default of
+		// user, sku, model and every enabled optional label. Dropping labels
+		// sums the series that only differed by them. team and plan are
+		// exported as assigning_team and plan_type.
+		Labels []string `json:"labels"`
+		// HasUsage publishes user_has_usage for every seat holder, including
+		// those without any usage series.
+		HasUsage bool `json:"hasUsage"`
+		// Staleness guards consumers against numbers from a collection that
+		// stopped succeeding.
+		Staleness struct {
+			// MaxAge is how many seconds old the latest published cycle may
+			// be; 0 disables the guard.
+			MaxAge int `json:"maxAge"`
+			// Policy is "unavailable" to answer /metrics with 503 or "drop"
+			// to leave the usage families out of it once MaxAge is exceeded.
+			Policy string `json:"policy"`
+		} `json:"staleness"`
+	} `json:"metrics"`
+	// Rules parameterise the rule file served at /rules/prometheus.yaml.
+	Rules struct {
+		// MonthlyBudget is the net spend in USD per enterprise above which
+		// the over budget alerts fire; they are left out when it is 0.
+		MonthlyBudget float64 `json:"monthlyBudget"`
+	} `json:"rules"`
+	// Tracing exports a span per collection cycle and GitHub request over
+	// OTLP/HTTP, which exemplars on the duration histograms refer to.
+	Tracing struct {
+		Enabled bool `json:"enabled"`
+		// Endpoint is the collector's OTLP/HTTP URL, such as
+		// http://otel-collector:4318. When empty the standard
+		// OTEL_EXPORTER_OTLP_ENDPOINT variables apply.
+		Endpoint string `json:"endpoint"`
+		// SampleRatio is the fraction of cycles traced, 1 by default.
+		SampleRatio float64 `json:"sampleRatio"`
+	} `json:"tracing"`
+}
+
+// Tenant is one enterprise of a multi-tenant deployment. Unset fields fall
+// back to the github settings.
+type Tenant struct {
+	// Name is the value of the tenant label on every per-cycle series.
+	Name       string   `json:"name"`
+	Enterprise string   `json:"enterprise"`
+	BaseURL    string   `json:"baseUrl"`
+	Subdomain  string   `json:"subdomain"`
+	Token      string   `json:"token"`
+	Tokens     []string `json:"tokens"`
+}
+
+// TenantNames returns the configured tenant names in order, nil for a
+// single-tenant deployment.
+func (c Config) TenantNames() []string {
+	var names []string
+	for _, t := range c.Tenants {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// CheckTenants reports tenants without a unique name.
+func (c Config) CheckTenants() error {
+	seen := make(map[string]bool, len(c.Tenants))
+	for i, t := range c.Tenants {
+		if t.Name == "" {
+			return fmt.Errorf("tenant %d has no name", i+1)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("duplicate tenant name %q", t.Name)
+		}
+		seen[t.Name] = true
+	}
+	return nil
+}
+
+// ForTenant returns the configuration t collects with: c with t's GitHub
+// settings applied.
+func (c Config) ForTenant(t Tenant) Config {
+	if t.Enterprise != "" {
+		c.Github.Enterprise = t.Enterprise
+	}
+	switch {
+	case t.BaseURL != "":
+		c.Github.BaseURL = t.BaseURL
+	case t.Subdomain != "":
+		c.Github.BaseURL = gheBaseURL(t.Subdomain)
+	}
+	if t.Token != "" || len(t.Tokens) > 0 {
+		c.Github.Token = t.Token
+		c.Github.Tokens = t.Tokens
+	}
+	return c
+}
+
+func gheBaseURL(subdomain string) string {
+	return "https://api." + subdomain + ".ghe.com"
 }
 
 const appConfPrefix = "CPUE"
 
+// Load builds the configuration from the optional JSON file named by
+// CPUE_CONFIGFILE, overlaid with any CPUE_* environment variables, with
+// defaults filled in last.
 func Load() (Config, error) {
 	var conf Config
+	if path := os.Getenv(appConfPrefix + "_CONFIGFILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return conf, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := json.Unmarshal(data, &conf); err != nil {
+			return conf, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
 	err := envconfig.Process(appConfPrefix, &conf)
 
+	if conf.ListenAddr == "" {
+		conf.ListenAddr = ":8080"
+	}
+	if conf.Admin.ListenAddr == "" {
+		conf.Admin.ListenAddr = ":9090"
+	}
+	if conf.Github.BaseURL == "" && conf.Github.Subdomain != "" {
+		conf.Github.BaseURL = gheBaseURL(conf.Github.Subdomain)
+	}
+	if conf.Source.Kind == "" {
+		conf.Source.Kind = "rest"
+	}
 	if conf.LogLevel == "" {
 		conf.LogLevel = "info"
 	}
 	if conf.WorkerInterval == 0 {
 		conf.WorkerInterval = 3600
 	}
+	if conf.CycleDeadline == 0 {
+		conf.CycleDeadline = conf.WorkerInterval
+	}
+	if conf.Quota.Business == 0 {
+		conf.Quota.Business = 300
+	}
+	if conf.Quota.Enterprise == 0 {
+		conf.Quota.Enterprise = 1000
+	}
+	if conf.License.Business == 0 {
+		conf.License.Business = 19
+	}
+	if conf.License.Enterprise == 0 {
+		conf.License.Enterprise = 39
+	}
+	if len(conf.Chargeback.Formats) == 0 {
+		conf.Chargeback.Formats = []string{"json", "csv"}
+	}
+	if conf.Identity.RefreshInterval == 0 {
+		conf.Identity.RefreshInterval = 86400
+	}
+	if conf.Org.Strategy == "" {
+		conf.Org.Strategy = "first"
+	}
+	if conf.LDAP.Filter == "" {
+		conf.LDAP.Filter = "(mail=%s)"
+	}
+	if conf.LDAP.DepartmentAttribute == "" {
+		conf.LDAP.DepartmentAttribute = "department"
+	}
+	if conf.LDAP.ManagerAttribute == "" {
+		conf.LDAP.ManagerAttribute = "manager"
+	}
+	if conf.LDAP.RefreshInterval == 0 {
+		conf.LDAP.RefreshInterval = 86400
+	}
+	// Azure workload identity injects these into the pod.
+	if conf.Entra.TenantID == "" {
+		conf.Entra.TenantID = os.Getenv("AZURE_TENANT_ID")
+	}
+	if conf.Entra.ClientID == "" {
+		conf.Entra.ClientID = os.Getenv("AZURE_CLIENT_ID")
+	}
+	if conf.Entra.FederatedTokenFile == "" && conf.Entra.ClientSecret == "" {
+		conf.Entra.FederatedTokenFile = os.Getenv("AZURE_FEDERATED_TOKEN_FILE")
+	}
+	if conf.Entra.RefreshInterval == 0 {
+		conf.Entra.RefreshInterval = 86400
+	}
+	if conf.Sinks.Datadog.Site == "" {
+		conf.Sinks.Datadog.Site = "datadoghq.com"
+	}
+	if conf.Sinks.Archive.Format == "" {
+		conf.Sinks.Archive.Format = "parquet"
+	}
+	if conf.Metrics.Namespace == "" {
+		conf.Metrics.Namespace = "github_copilot"
+	}
+	if conf.Billing.Timezone == "" {
+		conf.Billing.Timezone = "UTC"
+	}
+	if conf.HotRefresh.TopN == 0 {
+		conf.HotRefresh.TopN = 20
+	}
+	if conf.Anomaly.Window == 0 {
+		conf.Anomaly.Window = 14
+	}
+	if conf.Anomaly.MinDays == 0 {
+		conf.Anomaly.MinDays = 7
+	}
+	if conf.Anomaly.Threshold == 0 {
+		conf.Anomaly.Threshold = 3
+	}
+	if conf.Metrics.Staleness.Policy == "" {
+		conf.Metrics.Staleness.Policy = "unavailable"
+	}
+	if conf.Tracing.SampleRatio == 0 {
+		conf.Tracing.SampleRatio = 1
+	}
 
 	return conf, err
 }
+
+// redacted replaces a configured secret.
+const redacted = "REDACTED"
+
+// Redacted returns a copy of c with every secret masked, safe to show to
+// operators. Unset secrets stay empty so it is visible which are configured.
+func (c Config) Redacted() Config {
+	mask := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return redacted
+	}
+	maskAll := func(ss []string) []string {
+		out := make([]string, len(ss))
+		for i, s := range ss {
+			out[i] = mask(s)
+		}
+		return out
+	}
+
+	c.Admin.Token = mask(c.Admin.Token)
+	c.Github.Token = mask(c.Github.Token)
+	c.Github.Tokens = maskAll(c.Github.Tokens)
+	c.Tenants = slices.Clone(c.Tenants)
+	for i := range c.Tenants {
+		c.Tenants[i].Token = mask(c.Tenants[i].Token)
+		c.Tenants[i].Tokens = maskAll(c.Tenants[i].Tokens)
+	}
+	c.Sinks.Snowflake.DSN = redactDSN(c.Sinks.Snowflake.DSN)
+	c.Sinks.Kafka.Password = mask(c.Sinks.Kafka.Password)
+	c.Sinks.Datadog.APIKey = mask(c.Sinks.Datadog.APIKey)
+	c.LDAP.BindPassword = mask(c.LDAP.BindPassword)
+	c.Entra.ClientSecret = mask(c.Entra.ClientSecret)
+	c.Webhook.Secret = mask(c.Webhook.Secret)
+	return c
+}
+
+// dsnSecrets are the gosnowflake DSN parameters that carry credentials.
+var dsnSecrets = []string{"password", "passcode", "token", "privateKey", "oauthClientSecret", "proxyPassword"}
+
+// redactDSN masks the password in a user:password@account/... DSN and the
+// value of every credential parameter, keeping the account, database and
+// other parameters visible.
+func redactDSN(dsn string) string {
+	// Like gosnowflake, take the last @ as the end of the credentials and
+	// the first ? after it as the start of the parameters.
+	at := strings.LastIndex(dsn, "@")
+	base, query, hasQuery := strings.Cut(dsn[at+1:], "?")
+	if at >= 0 {
+		if colon := strings.Index(dsn[:at], ":"); colon >= 0 {
+			base = dsn[:colon+1] + redacted + "@" + base
+		} else {
+			base = dsn[:at+1] + base
+		}
+	}
+	if !hasQuery {
+		return base
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, _, ok := strings.Cut(param, "=")
+		if ok && slices.ContainsFunc(dsnSecrets, func(s string) bool { return strings.EqualFold(s, key) }) {
+			params[i] = key + "=" + redacted
+		}
+	}
+	return base + "?" + strings.Join(params, "&")
+}
+
+// ImmutableChanges lists the settings that differ between old and new but
+// only take effect at startup, such as the listen address or anything baked
+// into metric registration.
+func ImmutableChanges(old, new Config) []string {
+	var changed []string
+	if old.ConfigFile != new.ConfigFile {
+		changed = append(changed, "configFile")
+	}
+	if old.ListenAddr != new.ListenAddr {
+		changed = append(changed, "listenAddr")
+	}
+	if old.Admin != new.Admin {
+		changed = append(changed, "admin")
+	}
+	if !slices.Equal(old.TenantNames(), new.TenantNames()) {
+		changed = append(changed, "tenant names")
+	}
+	if old.LogLevel != new.LogLevel || old.LogDebug != new.LogDebug {
+		changed = append(changed, "logLevel")
+	}
+	if old.Webhook.Secret != new.Webhook.Secret || !slices.Equal(old.Webhook.Events, new.Webhook.Events) {
+		changed = append(changed, "webhook")
+	}
+	if old.Metrics.Namespace != new.Metrics.Namespace {
+		changed = append(changed, "metrics.namespace")
+	}
+	if !maps.Equal(old.Metrics.ExtraLabels, new.Metrics.ExtraLabels) {
+		changed = append(changed, "metrics.extraLabels")
+	}
+	if old.Metrics.AssigningTeamLabel != new.Metrics.AssigningTeamLabel {
+		changed = append(changed, "metrics.assigningTeamLabel")
+	}
+	if !slices.Equal(old.Metrics.Labels, new.Metrics.Labels) {
+		changed = append(changed, "metrics.labels")
+	}
+	if !slices.Equal(old.Metrics.CostBuckets, new.Metrics.CostBuckets) {
+		changed = append(changed, "metrics.costBuckets")
+	}
+	if old.Metrics.OpenMetrics != new.Metrics.OpenMetrics {
+		changed = append(changed, "metrics.openMetrics")
+	}
+	if old.Metrics.Staleness != new.Metrics.Staleness {
+		changed = append(changed, "metrics.staleness")
+	}
+	if old.Tracing != new.Tracing {
+		changed = append(changed, "tracing")
+	}
+	if old.Identity.Email != new.Identity.Email || (old.Identity.EmployeeIDAttribute == "") != (new.Identity.EmployeeIDAttribute == "") {
+		changed = append(changed, "identity labels")
+	}
+	if old.Org.Label != new.Org.Label {
+		changed = append(changed, "org label")
+	}
+	if (old.Bots.Mode == "label") != (new.Bots.Mode == "label") {
+		changed = append(changed, "bots label")
+	}
+	if (old.LDAP.URL == "") != (new.LDAP.URL == "") || old.LDAP.ManagerLabel != new.LDAP.ManagerLabel {
+		changed = append(changed, "ldap labels")
+	}
+	if (len(old.Entra.Groups) == 0) != (len(new.Entra.Groups) == 0) {
+		changed = append(changed, "entra labels")
+	}
+	return changed
+}
+
+// keepImmutable copies every startup-only setting from old into new.
+func keepImmutable(old Config, new *Config) {
+	new.ConfigFile = old.ConfigFile
+	new.ListenAddr = old.ListenAddr
+	new.Admin = old.Admin
+	if !slices.Equal(old.TenantNames(), new.TenantNames()) {
+		new.Tenants = old.Tenants
+	}
+	new.LogLevel = old.LogLevel
+	new.LogDebug = old.LogDebug
+	new.Webhook = old.Webhook
+	new.Metrics.Namespace = old.Metrics.Namespace
+	new.Metrics.ExtraLabels = old.Metrics.ExtraLabels
+	new.Metrics.AssigningTeamLabel = old.Metrics.AssigningTeamLabel
+	new.Metrics.Labels = old.Metrics.Labels
+	new.Metrics.CostBuckets = old.Metrics.CostBuckets
+	new.Metrics.OpenMetrics = old.Metrics.OpenMetrics
+	new.Metrics.Staleness = old.Metrics.Staleness
+	new.Tracing = old.Tracing
+	new.Identity.Email = old.Identity.Email
+	if (old.Identity.EmployeeIDAttribute == "") != (new.Identity.EmployeeIDAttribute == "") {
+		new.Identity.EmployeeIDAttribute = old.Identity.EmployeeIDAttribute
+	}
+	new.Org.Label = old.Org.Label
+	if (old.Bots.Mode == "label") != (new.Bots.Mode == "label") {
+		new.Bots.Mode = old.Bots.Mode
+	}
+	if (old.LDAP.URL == "") != (new.LDAP.URL == "") {
+		new.LDAP.URL = old.LDAP.URL
+	}
+	new.LDAP.ManagerLabel = old.LDAP.ManagerLabel
+	if (len(old.Entra.Groups) == 0) != (len(new.Entra.Groups) == 0) {
+		new.Entra.Groups = old.Entra.Groups
+	}
+}
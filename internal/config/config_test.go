@@ -0,0 +1,109 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestImmutableChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string
+	}{
+		{"nothing", func(c *Config) {}, nil},
+		{"reloadable setting", func(c *Config) { c.WorkerInterval = 600 }, nil},
+		{"listen address", func(c *Config) { c.ListenAddr = ":9999" }, []string{"listenAddr"}},
+		{"admin token", func(c *Config) { c.Admin.Token = "other" }, []string{"admin"}},
+		{"tenant renamed", func(c *Config) { c.Tenants[1].Name = "gamma" }, []string{"tenant names"}},
+		{"tenant token only", func(c *Config) { c.Tenants[1].Token = "rotated" }, nil},
+		{"log level", func(c *Config) { c.LogDebug = true }, []string{"logLevel"}},
+		{"webhook events", func(c *Config) { c.Webhook.Events = []string{"ping"} }, []string{"webhook"}},
+		{"metric labels", func(c *Config) { c.Metrics.Labels = []string{"user", "model"} }, []string{"metrics.labels"}},
+		{"extra labels", func(c *Config) { c.Metrics.ExtraLabels = map[string]string{"env": "prod"} }, []string{"metrics.extraLabels"}},
+		{"tracing", func(c *Config) { c.Tracing.SampleRatio = 0.5 }, []string{"tracing"}},
+		{"employee id attribute set", func(c *Config) { c.Identity.EmployeeIDAttribute = "employeeNumber" }, []string{"identity labels"}},
+		{"bots mode within exclusion", func(c *Config) { c.Bots.Mode = "include" }, nil},
+		{"bots mode to label", func(c *Config) { c.Bots.Mode = "label" }, []string{"bots label"}},
+		{"ldap url changed", func(c *Config) { c.LDAP.URL = "ldaps://other" }, nil},
+		{"ldap disabled", func(c *Config) { c.LDAP.URL = "" }, []string{"ldap labels"}},
+		{"entra groups enabled", func(c *Config) { c.Entra.Groups = []string{"g"} }, []string{"entra labels"}},
+		{
+			"several",
+			func(c *Config) { c.ListenAddr = ":9999"; c.Metrics.Namespace = "other" },
+			[]string{"listenAddr", "metrics.namespace"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := baseConfig()
+			new := baseConfig()
+			tt.change(&new)
+
+			if got := ImmutableChanges(old, new); !slices.Equal(got, tt.want) {
+				t.Fatalf("ImmutableChanges() = %v, want %v", got, tt.want)
+			}
+			keepImmutable(old, &new)
+			if got := ImmutableChanges(old, new); len(got) != 0 {
+				t.Errorf("after keepImmutable, ImmutableChanges() = %v, want none", got)
+			}
+		})
+	}
+}
+
+func TestKeepImmutableKeepsReloadableSettings(t *testing.T) {
+	old := baseConfig()
+	new := baseConfig()
+	new.WorkerInterval = 600
+	new.Tenants[1].Token = "rotated"
+	new.LDAP.URL = "ldaps://other"
+	new.Bots.Mode = "include"
+
+	keepImmutable(old, &new)
+	if new.WorkerInterval != 600 {
+		t.Errorf("WorkerInterval = %d, want 600", new.WorkerInterval)
+	}
+	if new.Tenants[1].Token != "rotated" {
+		t.Errorf("tenant token = %q, want rotated", new.Tenants[1].Token)
+	}
+	if new.LDAP.URL != "ldaps://other" {
+		t.Errorf("LDAP.URL = %q, want ldaps://other", new.LDAP.URL)
+	}
+	if new.Bots.Mode != "include" {
+		t.Errorf("Bots.Mode = %q, want include", new.Bots.Mode)
+	}
+}
+
+// baseConfig returns a configuration with two tenants and LDAP enabled, so
+// changes to either can be told apart from their absence.
+func baseConfig() Config {
+	var c Config
+	c.ListenAddr = ":8080"
+	c.WorkerInterval = 300
+	c.Tenants = []Tenant{{Name: "alpha", Token: "a"}, {Name: "beta", Token: "b"}}
+	c.Metrics.Namespace = "github_copilot"
+	c.Bots.Mode = "exclude"
+	c.LDAP.URL = "ldaps://directory"
+	c.Tracing.SampleRatio = 1
+	return c
+}
+
+func TestRedactDSN(t *testing.T) {
+	for _, tt := range []struct{ dsn, want string }{
+		{"acme/usage", "acme/usage"},
+		{"loader@acme/usage", "loader@acme/usage"},
+		{"loader:s3cr?t@acme/usage/public?warehouse=load", "loader:REDACTED@acme/usage/public?warehouse=load"},
+		{
+			"loader@acme/usage?authenticator=SNOWFLAKE_JWT&privateKey=MIIE&warehouse=load",
+			"loader@acme/usage?authenticator=SNOWFLAKE_JWT&privateKey=REDACTED&warehouse=load",
+		},
+		{
+			"acme/usage?token=abc&password=def&passcode=123&oauthClientSecret=x&proxyPassword=y",
+			"acme/usage?token=REDACTED&password=REDACTED&passcode=REDACTED&oauthClientSecret=REDACTED&proxyPassword=REDACTED",
+		},
+	} {
+		if got := redactDSN(tt.dsn); got != tt.want {
+			t.Errorf("redactDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
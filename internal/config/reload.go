@@ -0,0 +1,109 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const filePollInterval = 10 * time.Second
+
+// Reloader holds the live configuration and replaces it when the config file
+// changes on disk or the process receives SIGHUP. Startup-only settings are
+// never replaced; a change to one of them is logged as requiring a restart.
+type Reloader struct {
+	current  atomic.Pointer[Config]
+	override func(*Config)
+	logger   *zap.Logger
+	updated  chan struct{}
+}
+
+// NewReloader starts from conf. override, if non-nil, is applied to every
+// reloaded configuration so command-line or demo-mode settings survive a
+// reload.
+func NewReloader(conf Config, override func(*Config), logger *zap.Logger) *Reloader {
+	r := &Reloader{override: override, logger: logger, updated: make(chan struct{}, 1)}
+	r.current.Store(&conf)
+	return r
+}
+
+func (r *Reloader) Current() Config {
+	return *r.current.Load()
+}
+
+// Updated receives a value after each successful reload.
+func (r *Reloader) Updated() <-chan struct{} {
+	return r.updated
+}
+
+// Run watches for reload triggers until ctx is done.
+func (r *Reloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(filePollInterval)
+	defer ticker.Stop()
+
+	lastMod := r.modTime()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("received SIGHUP, reloading configuration")
+			r.reload()
+		case <-ticker.C:
+			if mod := r.modTime(); !mod.Equal(lastMod) {
+				lastMod = mod
+				r.logger.Info("config file changed, reloading configuration", zap.String("path", r.Current().ConfigFile))
+				r.reload()
+			}
+		}
+	}
+}
+
+func (r *Reloader) modTime() time.Time {
+	path := r.Current().ConfigFile
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (r *Reloader) reload() {
+	conf, err := Load()
+	if err != nil {
+		r.logger.Error("failed to reload configuration, keeping current", zap.Error(err))
+		return
+	}
+	if r.override != nil {
+		r.override(&conf)
+	}
+	if err := conf.Validate(); err != nil {
+		r.logger.Error("invalid reloaded configuration, keeping current", zap.Error(err))
+		return
+	}
+
+	old := r.Current()
+	if changed := ImmutableChanges(old, conf); len(changed) > 0 {
+		r.logger.Warn("ignoring changes to settings that require a restart", zap.Strings("settings", changed))
+		keepImmutable(old, &conf)
+	}
+
+	r.current.Store(&conf)
+	select {
+	case r.updated <- struct{}{}:
+	default:
+	}
+	r.logger.Info("configuration reloaded")
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// minWorkerInterval keeps a fixed interval from hammering the billing API,
+// whose numbers only change every few minutes anyway.
+const minWorkerInterval = 60
+
+// Validate reports every problem with c at once, joined into one error, so a
+// misconfigured deployment fails at startup with the full list instead of
+// one fix per restart or runtime 404s from an empty enterprise slug. It is
+// run after any command-line or demo-mode overrides have been applied.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	oneOf := func(field, value string, allowed ...string) {
+		check(slices.Contains(allowed, value), "%s must be one of %q, got %q", field, allowed, value)
+	}
+
+	if c.Schedule == "" {
+		check(c.WorkerInterval >= minWorkerInterval, "workerInterval must be at least %d seconds, got %d", minWorkerInterval, c.WorkerInterval)
+	}
+	check(c.WorkerJitter >= 0, "workerJitter must not be negative, got %d", c.WorkerJitter)
+	check(c.CycleDeadline > 0, "cycleDeadline must be positive, got %d", c.CycleDeadline)
+	check(c.Admin.CaptureResponses >= 0, "admin.captureResponses must not be negative, got %d", c.Admin.CaptureResponses)
+
+	oneOf("source.kind", c.Source.Kind, "rest", "replay")
+	check(c.Source.Kind != "replay" || c.Source.ReplayFile != "", "source.replayFile is required with source.kind replay")
+
+	if err := c.CheckTenants(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.Github.BaseURL == "" || c.Github.Subdomain == "" || c.Github.BaseURL == gheBaseURL(c.Github.Subdomain),
+		"github.baseUrl and github.subdomain are mutually exclusive")
+	for i, t := range c.Tenants {
+		check(t.BaseURL == "" || t.Subdomain == "", "tenant %q: baseUrl and subdomain are mutually exclusive", t.Name)
+		errs = append(errs, c.ForTenant(c.Tenants[i]).checkGithub(fmt.Sprintf("tenant %q: ", t.Name))...)
+	}
+	if len(c.Tenants) == 0 {
+		errs = append(errs, c.checkGithub("")...)
+	}
+	check(c.Github.PageSize >= 0 && c.Github.PageSize <= 100, "github.pageSize must be between 0 and 100, got %d", c.Github.PageSize)
+	check(c.Github.RateLimit.RequestsPerSecond >= 0, "github.rateLimit.requestsPerSecond must not be negative")
+	check(c.Github.RateLimit.Burst >= 0, "github.rateLimit.burst must not be negative, got %d", c.Github.RateLimit.Burst)
+
+	if _, err := time.LoadLocation(c.Billing.Timezone); err != nil {
+		errs = append(errs, fmt.Errorf("billing.timezone: %w", err))
+	}
+	check(c.Quota.Business >= 0 && c.Quota.Enterprise >= 0, "quota values must not be negative")
+	check(c.License.Business >= 0 && c.License.Enterprise >= 0, "license prices must not be negative")
+	check(c.HotRefresh.Interval == 0 || c.HotRefresh.Interval >= minWorkerInterval,
+		"hotRefresh.interval must be 0 or at least %d seconds, got %d", minWorkerInterval, c.HotRefresh.Interval)
+	check(c.HotRefresh.TopN >= 0, "hotRefresh.topN must not be negative, got %d", c.HotRefresh.TopN)
+	check(c.Anomaly.Window > 0, "anomaly.window must be positive, got %d", c.Anomaly.Window)
+	check(c.Anomaly.MinDays > 0 && c.Anomaly.MinDays <= c.Anomaly.Window,
+		"anomaly.minDays must be between 1 and anomaly.window, got %d", c.Anomaly.MinDays)
+	check(c.Anomaly.Threshold > 0, "anomaly.threshold must be positive, got %v", c.Anomaly.Threshold)
+	for _, f := range c.Chargeback.Formats {
+		oneOf("chargeback.formats", f, "json", "csv")
+	}
+
+	if bq := c.Sinks.BigQuery; bq.Table != "" {
+		check(bq.Project != "" && bq.Dataset != "", "sinks.bigquery.project and dataset are required with a table")
+	}
+	if sf := c.Sinks.Snowflake; sf.Table != "" {
+		check(sf.DSN != "", "sinks.snowflake.dsn is required with a table")
+	}
+	if kc := c.Sinks.Kafka; kc.Topic != "" {
+		check(len(kc.Brokers) > 0, "sinks.kafka.brokers is required with a topic")
+		oneOf("sinks.kafka.saslMechanism", kc.SASLMechanism, "", "plain", "scram-sha-256", "scram-sha-512")
+	}
+	oneOf("sinks.archive.format", c.Sinks.Archive.Format, "parquet", "csv")
+
+	oneOf("bots.mode", c.Bots.Mode, "", "label", "exclude")
+	for i, p := range c.Bots.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			errs = append(errs, fmt.Errorf("bots.patterns[%d]: %w", i, err))
+		}
+	}
+	oneOf("org.strategy", c.Org.Strategy, "first", "joined")
+	if c.LDAP.URL != "" {
+		check(c.LDAP.BaseDN != "", "ldap.baseDn is required with ldap.url")
+	}
+	if len(c.Entra.Groups) > 0 {
+		check(c.Entra.TenantID != "" && c.Entra.ClientID != "", "entra.tenantId and entra.clientId are required with entra.groups")
+		check(c.Entra.ClientSecret != "" || c.Entra.FederatedTokenFile != "", "entra.clientSecret or entra.federatedTokenFile is required with entra.groups")
+	}
+
+	check(slices.IsSorted(c.Metrics.CostBuckets) && !hasDuplicates(c.Metrics.CostBuckets), "metrics.costBuckets must be strictly increasing")
+	if len(c.Metrics.Labels) > 0 {
+		// Enrichment labels are only available with the stage that sets them.
+		available := map[string]bool{
+			"user": true, "sku": true, "model": true, "product": true, "unit_type": true,
+			"team": true, "cost_center": true, "plan": true,
+			"org":          c.Org.Label,
+			"email":        c.Identity.Email,
+			"employee_id":  c.Identity.EmployeeIDAttribute != "",
+			"department":   c.LDAP.URL != "",
+			"manager":      c.LDAP.URL != "" && c.LDAP.ManagerLabel,
+			"account_type": c.Bots.Mode == "label",
+			"group":        len(c.Entra.Groups) > 0,
+		}
+		seen := make(map[string]bool, len(c.Metrics.Labels))
+		for _, name := range c.Metrics.Labels {
+			enabled, known := available[name]
+			check(known, "metrics.labels: unknown label %q", name)
+			check(!known || enabled, "metrics.labels: label %q requires its enrichment to be enabled", name)
+			check(!seen[name], "metrics.labels: duplicate label %q", name)
+			seen[name] = true
+		}
+	}
+	check(c.Metrics.Staleness.MaxAge >= 0, "metrics.staleness.maxAge must not be negative, got %d", c.Metrics.Staleness.MaxAge)
+	oneOf("metrics.staleness.policy", c.Metrics.Staleness.Policy, "unavailable", "drop")
+
+	check(c.Rules.MonthlyBudget >= 0, "rules.monthlyBudget must not be negative")
+	check(c.Tracing.SampleRatio > 0 && c.Tracing.SampleRatio <= 1, "tracing.sampleRatio must be above 0 and at most 1, got %v", c.Tracing.SampleRatio)
+
+	return errors.Join(errs...)
+}
+
+// checkGithub reports the GitHub settings one enterprise cannot be collected
+// without, each prefixed with prefix.
+func (c Config) checkGithub(prefix string) []error {
+	var errs []error
+	if c.Github.Enterprise == "" {
+		errs = append(errs, fmt.Errorf("%sgithub.enterprise is required", prefix))
+	}
+	if c.Source.Kind == "rest" && c.Github.Token == "" && len(c.Github.Tokens) == 0 {
+		errs = append(errs, fmt.Errorf("%sgithub.token or github.tokens is required", prefix))
+	}
+	return errs
+}
+
+func hasDuplicates(sorted []float64) bool {
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			return true
+		}
+	}
+	return false
+}
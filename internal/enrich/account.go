@@ -0,0 +1,60 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+const (
+	AccountTypeUser = "user"
+	AccountTypeBot  = "bot"
+)
+
+// AccountType tells automation accounts from people: GitHub bot accounts,
+// plus machine users whose login matches one of the configured patterns.
+// As a stage it sets the account_type label.
+type AccountType struct {
+	patterns []*regexp.Regexp
+}
+
+// NewAccountType compiles patterns, regular expressions matched against the
+// login. Invalid patterns are skipped and reported in the error; the
+// returned AccountType is usable either way.
+func NewAccountType(patterns []string) (*AccountType, error) {
+	a := &AccountType{}
+	var errs []error
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("bot pattern %q: %w", p, err))
+			continue
+		}
+		a.patterns = append(a.patterns, re)
+	}
+	return a, errors.Join(errs...)
+}
+
+func (a *AccountType) Name() string { return "account_type" }
+
+func (a *AccountType) Labels() []string { return []string{"account_type"} }
+
+func (a *AccountType) Enrich(_ context.Context, users []*User) error {
+	for _, u := range users {
+		u.Labels["account_type"] = a.Classify(u)
+	}
+	return nil
+}
+
+func (a *AccountType) Classify(u *User) string {
+	if u.Type == "Bot" {
+		return AccountTypeBot
+	}
+	for _, re := range a.patterns {
+		if re.MatchString(u.Login) {
+			return AccountTypeBot
+		}
+	}
+	return AccountTypeUser
+}
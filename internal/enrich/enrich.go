@@ -0,0 +1,59 @@
+package enrich
+
+import (
+	"context"
+
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/logctx"
+	"go.uber.org/zap"
+)
+
+// User is a seat holder passing through the enrichment pipeline. Stages read
+// what earlier stages resolved (e.g. Email) and add label values of their own.
+type User struct {
+	Login string
+	// Type is the GitHub account type of the seat's assignee, e.g. "User"
+	// or "Bot".
+	Type          string
+	Email         string
+	Organizations []string
+	Labels        map[string]string
+}
+
+func NewUser(login string) *User {
+	return &User{Login: login, Labels: make(map[string]string)}
+}
+
+// Enricher is one stage of the pipeline.
+type Enricher interface {
+	Name() string
+	// Labels returns the metric label names this stage may set.
+	Labels() []string
+	Enrich(ctx context.Context, users []*User) error
+}
+
+// Pipeline runs enrichers in order. A failing stage is logged and skipped so
+// missing enrichment never blocks publishing usage.
+type Pipeline struct {
+	stages []Enricher
+	logger *zap.Logger
+}
+
+func NewPipeline(logger *zap.Logger, stages ...Enricher) *Pipeline {
+	return &Pipeline{stages: stages, logger: logger}
+}
+
+func (p *Pipeline) Labels() []string {
+	var labels []string
+	for _, s := range p.stages {
+		labels = append(labels, s.Labels()...)
+	}
+	return labels
+}
+
+func (p *Pipeline) Enrich(ctx context.Context, users []*User) {
+	for _, s := range p.stages {
+		if err := s.Enrich(ctx, users); err != nil {
+			logctx.From(ctx, p.logger).Warn("enrichment stage failed", zap.String("stage", s.Name()), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const graphBase = "https://graph.microsoft.com/v1.0"
+const graphScope = "https://graph.microsoft.com/.default"
+
+type EntraConfig struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// FederatedTokenFile is the projected service account token used for
+	// workload identity. When set it is used instead of ClientSecret.
+	FederatedTokenFile string
+	// Groups are the group display names or object IDs to match, in priority
+	// order: a user in several of them is labelled with the first.
+	Groups  []string
+	Refresh time.Duration
+}
+
+type entraEntry struct {
+	group     string
+	fetchedAt time.Time
+}
+
+// Entra resolves users by corporate email to one of a configured set of
+// Microsoft Entra ID groups via the Microsoft Graph API and sets the group
+// label. Lookups are cached for Refresh.
+type Entra struct {
+	conf       EntraConfig
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	cache       map[string]entraEntry
+	accessToken string
+	tokenExpiry time.Time
+}
+
+func NewEntra(conf EntraConfig) *Entra {
+	return &Entra{
+		conf:       conf,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		cache:      make(map[string]entraEntry),
+	}
+}
+
+func (e *Entra) Name() string { return "entra" }
+
+func (e *Entra) Labels() []string { return []string{"group"} }
+
+func (e *Entra) Enrich(ctx context.Context, users []*User) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var err error
+	for _, u := range users {
+		if u.Email == "" {
+			continue
+		}
+		key := strings.ToLower(u.Email)
+		entry, ok := e.cache[key]
+		if !ok || time.Since(entry.fetchedAt) >= e.conf.Refresh {
+			group, lookupErr := e.lookup(ctx, u.Email)
+			if lookupErr != nil {
+				// Keep going with the cache; report the first failure.
+				if err == nil {
+					err = lookupErr
+				}
+				if !ok {
+					continue
+				}
+			} else {
+				entry = entraEntry{group: group, fetchedAt: time.Now()}
+				e.cache[key] = entry
+			}
+		}
+		u.Labels["group"] = entry.group
+	}
+	return err
+}
+
+// lookup returns the first configured group the user is a transitive member
+// of, or "" if none. Users unknown to Entra are treated as members of none.
+func (e *Entra) lookup(ctx context.Context, email string) (string, error) {
+	token, err := e.token(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	memberOf := make(map[string]bool)
+	next := fmt.Sprintf("%s/users/%s/transitiveMemberOf/microsoft.graph.group?$select=id,displayName&$top=999",
+		graphBase, url.PathEscape(email))
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := e.httpClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return "", nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return "", fmt.Errorf("unexpected status %d for graph group lookup of %s", resp.StatusCode, email)
+		}
+
+		var page struct {
+			Value []struct {
+				ID          string `json:"id"`
+				DisplayName string `json:"displayName"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("decoding graph group lookup of %s: %w", email, err)
+		}
+
+		for _, g := range page.Value {
+			memberOf[strings.ToLower(g.ID)] = true
+			memberOf[strings.ToLower(g.DisplayName)] = true
+		}
+		next = page.NextLink
+	}
+
+	if i := slices.IndexFunc(e.conf.Groups, func(g string) bool { return memberOf[strings.ToLower(g)] }); i >= 0 {
+		return e.conf.Groups[i], nil
+	}
+	return "", nil
+}
+
+// token returns a cached Graph access token, requesting a new one with client
+// credentials or a federated workload identity assertion when it is about to
+// expire.
+func (e *Entra) token(ctx context.Context) (string, error) {
+	if e.accessToken != "" && time.Until(e.tokenExpiry) > time.Minute {
+		return e.accessToken, nil
+	}
+
+	form := url.Values{
+		"client_id":  {e.conf.ClientID},
+		"scope":      {graphScope},
+		"grant_type": {"client_credentials"},
+	}
+	if e.conf.FederatedTokenFile != "" {
+		assertion, err := os.ReadFile(e.conf.FederatedTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("reading federated token: %w", err)
+		}
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", strings.TrimSpace(string(assertion)))
+	} else {
+		form.Set("client_secret", e.conf.ClientSecret)
+	}
+
+	tokenURL := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", url.PathEscape(e.conf.TenantID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting graph token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d requesting graph token", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding graph token: %w", err)
+	}
+
+	e.accessToken = body.AccessToken
+	e.tokenExpiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	return e.accessToken, nil
+}
@@ -0,0 +1,96 @@
+package enrich
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/github"
+)
+
+type IdentitySource interface {
+	ListEnterpriseIdentities(ctx context.Context, enterprise string) (map[string]*github.Identity, error)
+}
+
+// Identity resolves each login to its enterprise SAML/SCIM identity and
+// organization memberships. It always fills User.Email and User.Organizations
+// for later stages; the email and employee_id labels are only
+// set when enabled. Identities are cached for refresh.
+type Identity struct {
+	source              IdentitySource
+	enterprise          string
+	refresh             time.Duration
+	emailLabel          bool
+	employeeIDAttribute string
+
+	mu         sync.Mutex
+	identities map[string]*github.Identity
+	fetchedAt  time.Time
+}
+
+func NewIdentity(source IdentitySource, enterprise string, refresh time.Duration, emailLabel bool, employeeIDAttribute string) *Identity {
+	return &Identity{
+		source:              source,
+		enterprise:          enterprise,
+		refresh:             refresh,
+		emailLabel:          emailLabel,
+		employeeIDAttribute: employeeIDAttribute,
+	}
+}
+
+func (i *Identity) Name() string { return "identity" }
+
+func (i *Identity) Labels() []string {
+	var labels []string
+	if i.emailLabel {
+		labels = append(labels, "email")
+	}
+	if i.employeeIDAttribute != "" {
+		labels = append(labels, "employee_id")
+	}
+	return labels
+}
+
+// Lookup returns the cached identities, refreshing them first when they are
+// older than the refresh interval.
+func (i *Identity) Lookup(ctx context.Context) (map[string]*github.Identity, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.identities != nil && time.Since(i.fetchedAt) < i.refresh {
+		return i.identities, nil
+	}
+	identities, err := i.source.ListEnterpriseIdentities(ctx, i.enterprise)
+	if err != nil {
+		// Serve stale identities rather than none.
+		if i.identities != nil {
+			return i.identities, err
+		}
+		return nil, err
+	}
+	i.identities = identities
+	i.fetchedAt = time.Now()
+	return identities, nil
+}
+
+func (i *Identity) Enrich(ctx context.Context, users []*User) error {
+	identities, err := i.Lookup(ctx)
+	for _, u := range users {
+		id, ok := identities[u.Login]
+		if !ok {
+			continue
+		}
+		u.Organizations = id.Organizations
+		u.Email = id.Email
+		if u.Email == "" {
+			u.Email = id.NameID
+		}
+		if i.emailLabel {
+			u.Labels["email"] = u.Email
+		}
+		if i.employeeIDAttribute != "" {
+			u.Labels["employee_id"] = id.Attributes[i.employeeIDAttribute]
+		}
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+type LDAPConfig struct {
+	URL                 string
+	BindDN              string
+	BindPassword        string
+	BaseDN              string
+	Filter              string
+	DepartmentAttribute string
+	ManagerAttribute    string
+	ManagerLabel        bool
+	Refresh             time.Duration
+}
+
+type ldapEntry struct {
+	department string
+	manager    string
+	fetchedAt  time.Time
+}
+
+// LDAP looks up each user's corporate email in a directory such as Active
+// Directory and sets the department label, plus the manager label when
+// enabled. Entries, including misses, are cached for Refresh so a cycle only
+// queries the directory for users it has not seen recently.
+type LDAP struct {
+	conf LDAPConfig
+
+	mu    sync.Mutex
+	cache map[string]ldapEntry
+}
+
+func NewLDAP(conf LDAPConfig) *LDAP {
+	return &LDAP{conf: conf, cache: make(map[string]ldapEntry)}
+}
+
+func (l *LDAP) Name() string { return "ldap" }
+
+func (l *LDAP) Labels() []string {
+	if l.conf.ManagerLabel {
+		return []string{"department", "manager"}
+	}
+	return []string{"department"}
+}
+
+func (l *LDAP) Enrich(ctx context.Context, users []*User) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var pending []string
+	for _, u := range users {
+		if u.Email == "" {
+			continue
+		}
+		if e, ok := l.cache[strings.ToLower(u.Email)]; !ok || time.Since(e.fetchedAt) >= l.conf.Refresh {
+			pending = append(pending, u.Email)
+		}
+	}
+
+	var err error
+	if len(pending) > 0 {
+		err = l.fetch(ctx, pending)
+	}
+
+	for _, u := range users {
+		e, ok := l.cache[strings.ToLower(u.Email)]
+		if !ok {
+			continue
+		}
+		u.Labels["department"] = e.department
+		if l.conf.ManagerLabel {
+			u.Labels["manager"] = e.manager
+		}
+	}
+	return err
+}
+
+func (l *LDAP) fetch(ctx context.Context, emails []string) error {
+	conn, err := ldap.DialURL(l.conf.URL)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", l.conf.URL, err)
+	}
+	defer conn.Close()
+
+	if l.conf.BindDN != "" {
+		if err := conn.Bind(l.conf.BindDN, l.conf.BindPassword); err != nil {
+			return fmt.Errorf("binding as %s: %w", l.conf.BindDN, err)
+		}
+	}
+
+	attributes := []string{l.conf.DepartmentAttribute}
+	if l.conf.ManagerAttribute != "" {
+		attributes = append(attributes, l.conf.ManagerAttribute)
+	}
+
+	for _, email := range emails {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		req := ldap.NewSearchRequest(
+			l.conf.BaseDN,
+			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 1, 0, false,
+			fmt.Sprintf(l.conf.Filter, ldap.EscapeFilter(email)),
+			attributes,
+			nil,
+		)
+		res, err := conn.Search(req)
+		if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return fmt.Errorf("searching for %s: %w", email, err)
+		}
+
+		entry := ldapEntry{fetchedAt: time.Now()}
+		if res != nil && len(res.Entries) > 0 {
+			entry.department = res.Entries[0].GetAttributeValue(l.conf.DepartmentAttribute)
+			if l.conf.ManagerAttribute != "" {
+				entry.manager = managerName(res.Entries[0].GetAttributeValue(l.conf.ManagerAttribute))
+			}
+		}
+		l.cache[strings.ToLower(email)] = entry
+	}
+	return nil
+}
+
+// managerName reduces a manager DN such as "CN=Jane Doe,OU=Staff,DC=corp" to
+// its first RDN value. Values that are not DNs are returned unchanged.
+func managerName(value string) string {
+	dn, err := ldap.ParseDN(value)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return value
+	}
+	return dn.RDNs[0].Attributes[0].Value
+}
@@ -0,0 +1,54 @@
+package enrich
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+const (
+	OrgStrategyFirst  = "first"
+	OrgStrategyJoined = "joined"
+)
+
+// Org sets the org label from the organizations a user belongs to within the
+// enterprise, as resolved by the identity stage. With OrgStrategyFirst a
+// single primary org is chosen: the first of preferred the user belongs to,
+// otherwise the alphabetically first. OrgStrategyJoined lists every org,
+// sorted and comma-separated.
+type Org struct {
+	strategy  string
+	preferred []string
+}
+
+func NewOrg(strategy string, preferred []string) *Org {
+	return &Org{strategy: strategy, preferred: preferred}
+}
+
+func (o *Org) Name() string { return "org" }
+
+func (o *Org) Labels() []string { return []string{"org"} }
+
+func (o *Org) Enrich(_ context.Context, users []*User) error {
+	for _, u := range users {
+		if len(u.Organizations) == 0 {
+			continue
+		}
+		u.Labels["org"] = o.primary(u.Organizations)
+	}
+	return nil
+}
+
+func (o *Org) primary(orgs []string) string {
+	sorted := slices.Clone(orgs)
+	slices.Sort(sorted)
+	if o.strategy == OrgStrategyJoined {
+		return strings.Join(sorted, ",")
+	}
+	for _, p := range o.preferred {
+		if slices.ContainsFunc(orgs, func(org string) bool { return strings.EqualFold(org, p) }) {
+			return p
+		}
+	}
+	return sorted[0]
+}
@@ -0,0 +1,63 @@
+package github
+
+import (
+	"context"
+	"fmt"
+)
+
+// BillingUsageItem is one line of the enhanced billing usage report: a day's
+// usage of one SKU by one organization or repository.
+type BillingUsageItem struct {
+	Date             string  `json:"date"`
+	Product          string  `json:"product"`
+	SKU              string  `json:"sku"`
+	Quantity         float64 `json:"quantity"`
+	UnitType         string  `json:"unitType"`
+	PricePerUnit     float64 `json:"pricePerUnit"`
+	GrossAmount      float64 `json:"grossAmount"`
+	DiscountAmount   float64 `json:"discountAmount"`
+	NetAmount        float64 `json:"netAmount"`
+	OrganizationName string  `json:"organizationName"`
+	RepositoryName   string  `json:"repositoryName"`
+}
+
+type BillingUsageResponse struct {
+	UsageItems []BillingUsageItem `json:"usageItems"`
+}
+
+// AdvancedSecurityCommitters is the enterprise-wide GitHub Advanced Security
+// committer count that licences are billed on.
+type AdvancedSecurityCommitters struct {
+	Total     int `json:"total_advanced_security_committers"`
+	Maximum   int `json:"maximum_advanced_security_committers"`
+	Purchased int `json:"purchased_advanced_security_committers"`
+}
+
+const endpointBillingUsage = "billing_usage"
+const endpointAdvancedSecurity = "advanced_security"
+
+// GetBillingUsage fetches the enterprise's usage of every metered product for
+// one calendar month.
+func (c *Client) GetBillingUsage(ctx context.Context, enterprise string, year, month int) ([]BillingUsageItem, error) {
+	url := fmt.Sprintf("%s/enterprises/%s/settings/billing/usage?year=%d&month=%d",
+		c.apiBase, enterprise, year, month)
+
+	var resp BillingUsageResponse
+	if err := c.get(ctx, endpointBillingUsage, url, &resp); err != nil {
+		return nil, fmt.Errorf("getting billing usage for %d-%02d: %w", year, month, err)
+	}
+	return resp.UsageItems, nil
+}
+
+// GetAdvancedSecurityCommitters reads the committer totals, which every page
+// of the per-repository listing carries, from a single-entry page.
+func (c *Client) GetAdvancedSecurityCommitters(ctx context.Context, enterprise string) (*AdvancedSecurityCommitters, error) {
+	url := fmt.Sprintf("%s/enterprises/%s/settings/billing/advanced-security?per_page=1",
+		c.apiBase, enterprise)
+
+	var resp AdvancedSecurityCommitters
+	if err := c.get(ctx, endpointAdvancedSecurity, url, &resp); err != nil {
+		return nil, fmt.Errorf("getting advanced security committers: %w", err)
+	}
+	return &resp, nil
+}
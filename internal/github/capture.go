@@ -0,0 +1,146 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// capturedHeaders are the only response headers kept in a capture, so tokens
+// and cookies can never end up in one.
+var capturedHeaders = []string{
+	"Content-Type",
+	"Date",
+	"X-GitHub-Request-Id",
+	"X-RateLimit-Remaining",
+	"X-RateLimit-Reset",
+}
+
+// redactedFields are the body fields, matched case-insensitively at any depth,
+// whose values a capture replaces with redactedValue, so captures do not
+// collect logins, email addresses or organization memberships.
+var redactedFields = map[string]bool{
+	"user":          true,
+	"login":         true,
+	"email":         true,
+	"name":          true,
+	"organization":  true,
+	"organizations": true,
+	"org":           true,
+}
+
+const redactedValue = "[redacted]"
+
+// CapturedResponse is a premium usage response as GitHub sent it, with the
+// identifying fields of its body redacted. User and URL still name the user
+// so captures can be looked up by login.
+type CapturedResponse struct {
+	CapturedAt time.Time         `json:"capturedAt"`
+	User       string            `json:"user"`
+	URL        string            `json:"url"`
+	Status     int               `json:"status"`
+	Headers    map[string]string `json:"headers"`
+	Body       json.RawMessage   `json:"body"`
+}
+
+// ResponseRing keeps the last N captured responses. It outlives clients so a
+// configuration reload does not clear it.
+type ResponseRing struct {
+	mu   sync.Mutex
+	buf  []CapturedResponse
+	next int
+	full bool
+}
+
+func NewResponseRing(size int) *ResponseRing {
+	return &ResponseRing{buf: make([]CapturedResponse, size)}
+}
+
+func (r *ResponseRing) add(user, url string, resp *http.Response, body []byte) {
+	headers := make(map[string]string, len(capturedHeaders))
+	for _, h := range capturedHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			headers[h] = v
+		}
+	}
+	captured := CapturedResponse{
+		CapturedAt: time.Now(),
+		User:       user,
+		URL:        url,
+		Status:     resp.StatusCode,
+		Headers:    headers,
+		Body:       redactBody(body),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = captured
+	r.next = (r.next + 1) % len(r.buf)
+	r.full = r.full || r.next == 0
+}
+
+// redactBody returns body with the values of redactedFields replaced. A body
+// that is not JSON is left out, since its contents cannot be redacted.
+func redactBody(body []byte) json.RawMessage {
+	// Numbers are kept as GitHub wrote them.
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		out, _ := json.Marshal(fmt.Sprintf("[%d bytes of non-JSON body omitted]", len(body)))
+		return out
+	}
+	out, err := json.Marshal(redact(v))
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if redactedFields[strings.ToLower(k)] {
+				v[k] = redactedValue
+			} else {
+				v[k] = redact(field)
+			}
+		}
+	case []any:
+		for i, elem := range v {
+			v[i] = redact(elem)
+		}
+	}
+	return v
+}
+
+// Responses returns the captured responses, newest first, optionally only
+// those for user.
+func (r *ResponseRing) Responses(user string) []CapturedResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = len(r.buf)
+	}
+	out := make([]CapturedResponse, 0, n)
+	for i := 1; i <= n; i++ {
+		c := r.buf[(r.next-i+len(r.buf))%len(r.buf)]
+		if user == "" || c.User == user {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// WithResponseCapture records every premium usage response in ring.
+func WithResponseCapture(ring *ResponseRing) Option {
+	return func(c *Client) {
+		c.capture = ring
+	}
+}
@@ -1,133 +1,522 @@
 package github
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/logctx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 )
 
-const apiBase = "https://api.github.com"
+const defaultAPIBase = "https://api.github.com"
+
+// Endpoint names used as the endpoint label of the API metrics.
+const (
+	endpointSeats        = "copilot_seats"
+	endpointPremiumUsage = "premium_request_usage"
+	endpointGraphQL      = "graphql"
+	endpointRateLimit    = "rate_limit"
+)
 const apiVersion = "2022-11-28"
 const maxRetries = 3
 const defaultFallbackSleep = 60 * time.Second
 const rateLimitResetBuffer = 5 * time.Second
+const waitProgressInterval = time.Minute
+
+// tokenExpiryWarning is how long before a token expires the client starts
+// warning about it, once a day per token.
+const tokenExpiryWarning = 7 * 24 * time.Hour
+const defaultPageSize = 100
+const maxPageSize = 100
 
 type Client struct {
-	httpClient         *http.Client
-	token              string
-	logger             *zap.Logger
-	rateLimitRemaining int
-	rateLimitReset     time.Time
+	httpClient  *http.Client
+	apiBase     string
+	tokens      *tokenPool
+	tokenPrefix string
+	pageSize    int
+	limiter     *rate.Limiter
+	capture     *ResponseRing
+	logger      *zap.Logger
+	requests    atomic.Int64
+}
+
+// Stats is a point-in-time view of the client's request counters and the
+// last observed core rate-limit state of each token.
+type Stats struct {
+	Requests int64
+	Tokens   []TokenStats
+}
+
+type TokenStats struct {
+	Name               string
+	Requests           int64
+	RateLimitRemaining int
+	RateLimitReset     time.Time
+}
+
+func (c *Client) Stats() Stats {
+	return Stats{
+		Requests: c.requests.Load(),
+		Tokens:   c.tokens.stats(),
+	}
+}
+
+// RateLimitConsumedSince returns how much of the rate limit was used between
+// prev and s, summed over all tokens. For a token whose limit window rolled
+// over in between, or with no remaining count observed yet, the number of
+// requests it made is used instead.
+func (s Stats) RateLimitConsumedSince(prev Stats) int {
+	previous := make(map[string]TokenStats, len(prev.Tokens))
+	for _, t := range prev.Tokens {
+		previous[t.Name] = t
+	}
+
+	consumed := 0
+	for _, t := range s.Tokens {
+		p := previous[t.Name]
+		if p.Name != "" && p.RateLimitRemaining >= 0 && p.RateLimitReset.Equal(t.RateLimitReset) {
+			consumed += p.RateLimitRemaining - t.RateLimitRemaining
+		} else {
+			consumed += int(t.Requests - p.Requests)
+		}
+	}
+	return consumed
+}
+
+type Option func(*Client)
+
+// WithBaseURL points the client at a different API root, e.g. a fake server
+// from githubtest. Trailing slashes are ignored.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.apiBase = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithTokens adds further tokens to rotate between. Requests go to whichever
+// token has the most rate limit remaining, so a cycle only has to wait once
+// every token is exhausted.
+func WithTokens(tokens ...string) Option {
+	return func(c *Client) {
+		values := make([]string, 0, len(c.tokens.tokens)+len(tokens))
+		for _, t := range c.tokens.tokens {
+			values = append(values, t.value)
+		}
+		c.tokens = newTokenPool(append(values, tokens...))
+	}
+}
+
+// WithPageSize sets per_page for paginated listings, capped at GitHub's
+// maximum of 100.
+func WithPageSize(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.pageSize = min(n, maxPageSize)
+		}
+	}
+}
+
+// WithRateLimit paces every request through a token bucket refilled at
+// perSecond with room for burst requests, keeping the client under GitHub's
+// secondary rate limits regardless of how many callers share it. It is
+// applied before, and independently of, the reactive 403/429 handling.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(c *Client) {
+		if perSecond > 0 {
+			c.limiter = rate.NewLimiter(rate.Limit(perSecond), max(burst, 1))
+		}
+	}
+}
+
+// WithTokenPrefix prefixes the token names used in logs and metrics, e.g.
+// "eu/token1", so several clients' tokens can be told apart.
+func WithTokenPrefix(prefix string) Option {
+	return func(c *Client) {
+		c.tokenPrefix = prefix
+	}
 }
 
-func NewClient(token string, logger *zap.Logger) *Client {
-	return &Client{
-		httpClient:         &http.Client{},
-		token:              token,
-		logger:             logger,
-		rateLimitRemaining: -1,
+func NewClient(token string, logger *zap.Logger, opts ...Option) *Client {
+	c := &Client{
+		httpClient: &http.Client{Transport: newTransport(TransportConfig{})},
+		apiBase:    defaultAPIBase,
+		tokens:     newTokenPool([]string{token}),
+		pageSize:   defaultPageSize,
+		logger:     logger,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.tokenPrefix != "" {
+		for _, t := range c.tokens.tokens {
+			t.name = c.tokenPrefix + "/" + t.name
+		}
+	}
+	return c
 }
 
-func (c *Client) updateRateLimit(resp *http.Response) {
+func (c *Client) updateRateLimit(t *token, resp *http.Response) {
+	resource := resp.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = coreResource
+	}
+	remaining := -1
+	var reset time.Time
 	if s := resp.Header.Get("X-RateLimit-Remaining"); s != "" {
 		if n, err := strconv.Atoi(s); err == nil {
-			c.rateLimitRemaining = n
+			remaining = n
+			internal.RateLimitRemaining.WithLabelValues(t.name, resource).Set(float64(n))
 		}
 	}
 	if s := resp.Header.Get("X-RateLimit-Reset"); s != "" {
 		if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
-			c.rateLimitReset = time.Unix(unix, 0)
+			reset = time.Unix(unix, 0)
+			internal.RateLimitReset.WithLabelValues(t.name, resource).Set(float64(unix))
 		}
 	}
+	c.tokens.update(t, resource, remaining, reset)
+}
+
+// updateExpiration records when t expires from the
+// GitHub-Authentication-Token-Expiration header, which GitHub only sends for
+// tokens with an expiry such as fine-grained personal access tokens.
+func (c *Client) updateExpiration(ctx context.Context, t *token, resp *http.Response) {
+	s := resp.Header.Get("GitHub-Authentication-Token-Expiration")
+	if s == "" {
+		return
+	}
+	var expires time.Time
+	var err error
+	for _, layout := range []string{"2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 -0700"} {
+		if expires, err = time.Parse(layout, s); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		c.log(ctx).Debug("unparseable token expiration header", zap.String("token", t.name), zap.String("value", s))
+		return
+	}
+	internal.TokenExpiration.WithLabelValues(t.name).Set(float64(expires.Unix()))
+	now := time.Now()
+	if expires.Sub(now) < tokenExpiryWarning && c.tokens.warnExpiry(t, now) {
+		c.log(ctx).Warn("github token expires soon, rotate it before collection starts failing",
+			zap.String("token", t.name),
+			zap.Time("expiresAt", expires),
+		)
+	}
 }
 
-func (c *Client) setHeaders(req *http.Request) {
+// throttle blocks until the client-side rate limiter admits another request.
+func (c *Client) throttle(ctx context.Context) error {
+	if c.limiter == nil {
+		return nil
+	}
+	r := c.limiter.Reserve()
+	d := r.Delay()
+	if d == 0 {
+		return nil
+	}
+	if err := c.wait(ctx, d, "client_rate_limit"); err != nil {
+		r.Cancel()
+		return err
+	}
+	return nil
+}
+
+// tracer starts a client span per GitHub request, nested under the span of
+// the cycle that made it.
+var tracer = otel.Tracer("go.dfds.cloud/copilot-premium-usage-exporter/internal/github")
+
+// send performs a single HTTP round trip in its own span, recording its
+// outcome and latency per endpoint. Transport failures are counted with
+// status "error".
+func (c *Client) send(req *http.Request, endpoint string) (*http.Response, error) {
+	ctx, span := tracer.Start(req.Context(), req.Method+" "+endpoint, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+		))
+	defer span.End()
+	req = req.WithContext(ctx)
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	elapsed := time.Since(start)
+	status, requestID := "error", ""
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+		requestID = resp.Header.Get("X-GitHub-Request-Id")
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", resp.StatusCode),
+			attribute.String("github.request_id", requestID),
+		)
+		if resp.StatusCode >= 400 {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	} else {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	// The request ID is what GitHub support asks for about a slow request.
+	internal.ObserveWithExemplar(internal.APIRequestDuration.WithLabelValues(endpoint), elapsed.Seconds(),
+		internal.Exemplar(req.Context(), prometheus.Labels{"github_request_id": requestID}))
+	internal.APIRequests.WithLabelValues(endpoint, status).Inc()
+	c.log(req.Context()).Debug("github request",
+		zap.String("endpoint", endpoint),
+		zap.String("url", req.URL.String()),
+		zap.String("status", status),
+		zap.String("requestId", requestID),
+		zap.Duration("duration", elapsed),
+	)
+	return resp, err
+}
+
+// log returns the logger carried by ctx, e.g. one scoped to a collection
+// cycle, or the client's own.
+func (c *Client) log(ctx context.Context) *zap.Logger {
+	return logctx.From(ctx, c.logger)
+}
+
+func (c *Client) setHeaders(req *http.Request, t *token) {
 	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Authorization", "Bearer "+t.value)
 	req.Header.Set("X-GitHub-Api-Version", apiVersion)
 }
 
+// wait blocks for d or until ctx is done, whichever comes first. Waits longer
+// than waitProgressInterval log their progress so a stalled cycle is visible.
+func (c *Client) wait(ctx context.Context, d time.Duration, reason string) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	internal.APIWaits.WithLabelValues(reason).Inc()
+	start := time.Now()
+	defer func() {
+		internal.APIWaitSeconds.WithLabelValues(reason).Add(time.Since(start).Seconds())
+	}()
+
+	var progress <-chan time.Time
+	if d > waitProgressInterval {
+		ticker := time.NewTicker(waitProgressInterval)
+		defer ticker.Stop()
+		progress = ticker.C
+	}
+
+	deadline := time.Now().Add(d)
+	for {
+		select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-progress:
+			c.log(ctx).Info("still waiting for github rate limit",
+				zap.String("reason", reason),
+				zap.Duration("remaining", time.Until(deadline).Round(time.Second)),
+			)
+		}
+	}
+}
+
 // sleepSecondaryRateLimit handles a 429 response by sleeping for the duration
 // specified in the Retry-After header. Falls back to defaultFallbackSleep if
 // the header is absent or unparseable. Always drains and closes the body.
-func sleepSecondaryRateLimit(resp *http.Response) time.Duration {
+// Returns early with ctx's error if ctx is cancelled while waiting.
+func (c *Client) sleepSecondaryRateLimit(ctx context.Context, resp *http.Response) (time.Duration, error) {
 	io.Copy(io.Discard, resp.Body)
 	resp.Body.Close()
+	d := defaultFallbackSleep
 	if s := resp.Header.Get("Retry-After"); s != "" {
 		if secs, err := strconv.ParseInt(s, 10, 64); err == nil && secs > 0 {
-			d := time.Duration(secs) * time.Second
-			time.Sleep(d)
-			return d
+			d = time.Duration(secs) * time.Second
 		}
 	}
-	time.Sleep(defaultFallbackSleep)
-	return defaultFallbackSleep
+	return d, c.wait(ctx, d, "secondary")
 }
 
 // sleepPrimaryRateLimit handles a 403+X-RateLimit-Remaining=0 response by
 // sleeping until the reset time from X-RateLimit-Reset (plus a small buffer).
 // Falls back to defaultFallbackSleep if the header is absent or unparseable.
-// Always drains and closes the body.
-func sleepPrimaryRateLimit(resp *http.Response) time.Duration {
+// Always drains and closes the body. Returns early with ctx's error if ctx is
+// cancelled while waiting.
+func (c *Client) sleepPrimaryRateLimit(ctx context.Context, resp *http.Response) (time.Duration, error) {
 	io.Copy(io.Discard, resp.Body)
 	resp.Body.Close()
+	d := defaultFallbackSleep
 	if s := resp.Header.Get("X-RateLimit-Reset"); s != "" {
 		if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
-			if d := time.Until(time.Unix(unix, 0)) + rateLimitResetBuffer; d > 0 {
-				time.Sleep(d)
-				return d
+			if until := time.Until(time.Unix(unix, 0)) + rateLimitResetBuffer; until > 0 {
+				d = until
 			}
 		}
 	}
-	time.Sleep(defaultFallbackSleep)
-	return defaultFallbackSleep
+	return d, c.wait(ctx, d, "primary")
+}
+
+// userParam returns the user query parameter of a premium usage URL.
+func userParam(rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("user")
+}
+
+func (c *Client) get(ctx context.Context, endpoint, url string, out any) error {
+	_, err := c.do(ctx, endpoint, http.MethodGet, url, nil, coreResource, out)
+	return err
+}
+
+// getPage is get for paginated endpoints. It returns the URL of the next page
+// from the Link header, or "" on the last page.
+func (c *Client) getPage(ctx context.Context, endpoint, url string, out any) (string, error) {
+	header, err := c.do(ctx, endpoint, http.MethodGet, url, nil, coreResource, out)
+	if err != nil {
+		return "", err
+	}
+	return nextLink(header.Get("Link")), nil
 }
 
-func (c *Client) get(url string, out any) error {
-	if c.rateLimitRemaining == 0 {
-		if d := time.Until(c.rateLimitReset) + rateLimitResetBuffer; d > 0 {
-			c.logger.Info("preemptively waiting for github rate limit reset",
+// nextLink extracts the rel="next" target from an RFC 8288 Link header such
+// as `<https://api.github.com/...&page=2>; rel="next", <...>; rel="last"`.
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+		if !ok {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if name != "rel" {
+				continue
+			}
+			for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+				if rel == "next" {
+					return strings.Trim(strings.TrimSpace(target), "<>")
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// do sends a request, retrying through rate limits, and decodes a 200 response
+// body into out, returning the response headers. endpoint names the API for
+// metrics, and resource selects which rate limit ("core", "graphql") is used
+// to pick a token.
+func (c *Client) do(ctx context.Context, endpoint, method, url string, body []byte, resource string, out any) (http.Header, error) {
+	// attempt only advances when the client has to wait; switching to another
+	// token that still has rate limit left is free, up to once per token.
+	rotations := 0
+	serverErrors := 0
+	networkErrors := 0
+	for attempt := 0; attempt < maxRetries; {
+		tok, d := c.tokens.acquire(resource)
+		if d > 0 {
+			c.log(ctx).Info("preemptively waiting for github rate limit reset",
+				zap.String("token", tok.name),
 				zap.Duration("wait", d),
-				zap.Time("resetAt", c.rateLimitReset),
+				zap.Time("resetAt", time.Now().Add(d)),
 			)
-			time.Sleep(d)
+			if err := c.wait(ctx, d, "preemptive"); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := c.throttle(ctx); err != nil {
+			return nil, err
 		}
-	}
 
-	for attempt := range maxRetries {
-		req, err := http.NewRequest(http.MethodGet, url, nil)
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		c.setHeaders(req, tok)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
 		}
-		c.setHeaders(req)
 
-		resp, err := c.httpClient.Do(req)
+		resp, err := c.send(req, endpoint)
 		if err != nil {
-			return err
+			if ctx.Err() != nil || !retryableNetworkError(err) || networkErrors == maxNetworkErrorRetries {
+				return nil, err
+			}
+			networkErrors++
+			d := backoff(networkErrors)
+			c.log(ctx).Warn("github request failed with transient network error, retrying",
+				zap.String("url", url),
+				zap.Duration("backoff", d),
+				zap.Int("retriesRemaining", maxNetworkErrorRetries-networkErrors),
+				zap.Error(err),
+			)
+			internal.NetworkErrorRetries.Inc()
+			if err := c.wait(ctx, d, "network_error"); err != nil {
+				return nil, err
+			}
+			continue
 		}
+		c.requests.Add(1)
+		c.updateRateLimit(tok, resp)
+		c.updateExpiration(ctx, tok, resp)
 
 		switch resp.StatusCode {
 		case http.StatusOK:
-			c.updateRateLimit(resp)
 			defer resp.Body.Close()
-			return json.NewDecoder(resp.Body).Decode(out)
+			var r io.Reader = resp.Body
+			var raw bytes.Buffer
+			if c.capture != nil && endpoint == endpointPremiumUsage {
+				r = io.TeeReader(resp.Body, &raw)
+			}
+			dec := json.NewDecoder(r)
+			var err error
+			if sd, ok := out.(streamDecoder); ok {
+				err = sd.decodeFrom(dec)
+			} else {
+				err = dec.Decode(out)
+			}
+			if r != resp.Body {
+				io.Copy(&raw, resp.Body)
+				c.capture.add(userParam(url), url, resp, raw.Bytes())
+			}
+			if err != nil {
+				return nil, &DecodeError{URL: url, Err: err}
+			}
+			return resp.Header, nil
 
 		case http.StatusTooManyRequests: // 429 secondary rate limit
-			retriesRemaining := maxRetries - attempt - 1
-			waited := sleepSecondaryRateLimit(resp)
-			c.logger.Warn("github secondary rate limit hit",
+			attempt++
+			retriesRemaining := maxRetries - attempt
+			waited, err := c.sleepSecondaryRateLimit(ctx, resp)
+			if err != nil {
+				return nil, err
+			}
+			c.log(ctx).Warn("github secondary rate limit hit",
 				zap.String("url", url),
 				zap.Duration("waited", waited),
 				zap.Int("retriesRemaining", retriesRemaining),
 			)
 			if retriesRemaining == 0 {
-				return fmt.Errorf("secondary rate limited on %s after %d retries", url, maxRetries)
+				return nil, &RateLimitError{Secondary: true, URL: url, Retries: maxRetries}
 			}
 
 		case http.StatusForbidden:
@@ -135,62 +524,113 @@ func (c *Client) get(url string, out any) error {
 				// Not a rate limit (auth error, permissions, etc.) — fail immediately.
 				io.Copy(io.Discard, resp.Body)
 				resp.Body.Close()
-				return fmt.Errorf("unexpected status %d for %s", resp.StatusCode, url)
+				return nil, &StatusError{StatusCode: resp.StatusCode, URL: url}
 			}
 			// Primary rate limit exhausted.
-			retriesRemaining := maxRetries - attempt - 1
-			waited := sleepPrimaryRateLimit(resp)
-			c.logger.Warn("github primary rate limit hit",
+			if rotations < c.tokens.size()-1 && c.tokens.availableBesides(tok, resource) {
+				rotations++
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				c.log(ctx).Info("github token rate limit exhausted, rotating to next token",
+					zap.String("token", tok.name),
+					zap.String("url", url),
+				)
+				continue
+			}
+			attempt++
+			rotations = 0
+			retriesRemaining := maxRetries - attempt
+			waited, err := c.sleepPrimaryRateLimit(ctx, resp)
+			if err != nil {
+				return nil, err
+			}
+			c.log(ctx).Warn("github primary rate limit hit",
 				zap.String("url", url),
 				zap.Duration("waited", waited),
 				zap.Int("retriesRemaining", retriesRemaining),
 			)
 			if retriesRemaining == 0 {
-				return fmt.Errorf("primary rate limited on %s after %d retries", url, maxRetries)
+				return nil, &RateLimitError{URL: url, Retries: maxRetries}
+			}
+
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if serverErrors == maxServerErrorRetries {
+				return nil, &StatusError{StatusCode: resp.StatusCode, URL: url}
+			}
+			serverErrors++
+			d := backoff(serverErrors)
+			c.log(ctx).Warn("github server error, retrying",
+				zap.String("url", url),
+				zap.Int("status", resp.StatusCode),
+				zap.Duration("backoff", d),
+				zap.Int("retriesRemaining", maxServerErrorRetries-serverErrors),
+			)
+			internal.ServerErrorRetries.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+			if err := c.wait(ctx, d, "server_error"); err != nil {
+				return nil, err
 			}
 
 		default:
 			io.Copy(io.Discard, resp.Body)
 			resp.Body.Close()
-			return fmt.Errorf("unexpected status %d for %s", resp.StatusCode, url)
+			return nil, &StatusError{StatusCode: resp.StatusCode, URL: url}
 		}
 	}
-	return fmt.Errorf("get %s: exceeded max retries", url)
+	return nil, fmt.Errorf("%s %s: exceeded max retries", strings.ToLower(method), url)
 }
 
-func (c *Client) ListCopilotSeats(enterprise string) ([]string, error) {
-	var logins []string
-	page := 1
-	perPage := 100
-
-	for {
-		url := fmt.Sprintf("%s/enterprises/%s/copilot/billing/seats?per_page=%d&page=%d",
-			apiBase, enterprise, perPage, page)
-
-		var resp SeatsResponse
-		if err := c.get(url, &resp); err != nil {
-			return nil, fmt.Errorf("listing copilot seats page %d: %w", page, err)
+// ListSeats follows the Link header through every page of seats. It also
+// returns the total GitHub reports, which callers can compare with the number
+// of seats listed to detect an incomplete listing.
+func (c *Client) ListSeats(ctx context.Context, enterprise string) ([]CopilotSeat, int, error) {
+	var seats []CopilotSeat
+	total := 0
+	err := c.EachSeatPage(ctx, enterprise, func(page []CopilotSeat, pageTotal int) error {
+		if seats == nil {
+			seats = make([]CopilotSeat, 0, max(pageTotal, len(page)))
 		}
+		seats = append(seats, page...)
+		total = pageTotal
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return seats, total, nil
+}
 
-		for _, seat := range resp.Seats {
-			logins = append(logins, seat.Assignee.Login)
-		}
+// EachSeatPage follows the Link header through every page of seats like
+// ListSeats, but hands each page to fn as it arrives instead of collecting
+// them, so only one page is ever held. The page is decoded into the same
+// slice every time, so fn must not keep it. An error from fn stops the
+// listing and is returned as is.
+func (c *Client) EachSeatPage(ctx context.Context, enterprise string, fn func(seats []CopilotSeat, total int) error) error {
+	url := fmt.Sprintf("%s/enterprises/%s/copilot/billing/seats?per_page=%d&page=1",
+		c.apiBase, enterprise, c.pageSize)
 
-		if len(resp.Seats) < perPage {
-			break
+	var resp SeatsResponse
+	for page := 1; url != ""; page++ {
+		resp.Seats = resp.Seats[:0]
+		next, err := c.getPage(ctx, endpointSeats, url, &resp)
+		if err != nil {
+			return fmt.Errorf("listing copilot seats page %d: %w", page, err)
 		}
-		page++
+		if err := fn(resp.Seats, resp.TotalSeats); err != nil {
+			return err
+		}
+		url = next
 	}
-
-	return logins, nil
+	return nil
 }
 
-func (c *Client) GetUserPremiumUsage(enterprise, user string) (*UsageResponse, error) {
+func (c *Client) GetUsage(ctx context.Context, enterprise, user string) (*UsageResponse, error) {
 	url := fmt.Sprintf("%s/enterprises/%s/settings/billing/premium_request/usage?user=%s",
-		apiBase, enterprise, user)
+		c.apiBase, enterprise, user)
 
 	var resp UsageResponse
-	if err := c.get(url, &resp); err != nil {
+	if err := c.get(ctx, endpointPremiumUsage, url, &resp); err != nil {
 		return nil, fmt.Errorf("getting premium usage for user %q: %w", user, err)
 	}
 
@@ -0,0 +1,266 @@
+package github_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/github"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/github/githubtest"
+	"go.uber.org/zap"
+)
+
+// seatPages serves seats seats a hundred per page from bodies rendered up
+// front, so the benchmark measures the client rather than the server.
+func seatPages(b *testing.B, seats int) *httptest.Server {
+	b.Helper()
+	const perPage = 100
+	var pages [][]byte
+	for start := 0; start < seats; start += perPage {
+		resp := github.SeatsResponse{TotalSeats: seats}
+		for i := start; i < min(start+perPage, seats); i++ {
+			resp.Seats = append(resp.Seats, github.CopilotSeat{
+				Assignee:      github.Assignee{Login: fmt.Sprintf("user-%d", i), Type: "User"},
+				AssigningTeam: &github.Team{Slug: "team", Name: "team"},
+				PlanType:      "business",
+			})
+		}
+		body, err := json.Marshal(resp)
+		if err != nil {
+			b.Fatal(err)
+		}
+		pages = append(pages, body)
+	}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 || page > len(pages) {
+			http.NotFound(w, r)
+			return
+		}
+		if page < len(pages) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?per_page=%d&page=%d>; rel="next"`, srv.URL, r.URL.Path, perPage, page+1))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(pages[page-1])
+	}))
+	return srv
+}
+
+// BenchmarkSeats compares listing every seat of a large enterprise at once
+// with handing them over a page at a time.
+func BenchmarkSeats(b *testing.B) {
+	for _, seats := range []int{10000, 100000} {
+		srv := seatPages(b, seats)
+		c := github.NewClient("token", zap.NewNop(), github.WithBaseURL(srv.URL), github.WithPageSize(100))
+		b.Run(fmt.Sprintf("ListSeats/seats=%d", seats), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, _, err := c.ListSeats(context.Background(), "bench"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("EachSeatPage/seats=%d", seats), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				err := c.EachSeatPage(context.Background(), "bench", func([]github.CopilotSeat, int) error { return nil })
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		srv.Close()
+	}
+}
+
+func TestSeatPagination(t *testing.T) {
+	srv := githubtest.NewServer(githubtest.Options{Enterprise: "test", Seats: 7})
+	defer srv.Close()
+	c := github.NewClient("token", zap.NewNop(), github.WithBaseURL(srv.URL), github.WithPageSize(3))
+
+	var pages []int
+	err := c.EachSeatPage(context.Background(), "test", func(seats []github.CopilotSeat, total int) error {
+		if total != 7 {
+			t.Errorf("page reports %d seats in total, want 7", total)
+		}
+		pages = append(pages, len(seats))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{3, 3, 1}; !slices.Equal(pages, want) {
+		t.Errorf("got pages of %v seats, want %v", pages, want)
+	}
+
+	seats, total, err := c.ListSeats(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seats) != 7 || total != 7 {
+		t.Errorf("listed %d of %d seats, want 7 of 7", len(seats), total)
+	}
+	for i, seat := range seats {
+		if seat.Assignee.Login != srv.Login(i) {
+			t.Errorf("seat %d is %q, want %q", i, seat.Assignee.Login, srv.Login(i))
+		}
+	}
+	if got := srv.Requests(); got != 6 {
+		t.Errorf("served %d requests, want 6", got)
+	}
+}
+
+// TestUsageRetries fetches the usage of a few users from a server that fails
+// some of the requests, checking which failures are retried and which tokens
+// end up used.
+func TestUsageRetries(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		opts         githubtest.Options
+		extraTokens  []string
+		users        int
+		wantRequests int
+		wantTokens   int
+		wantGone     bool
+	}{
+		{
+			name:         "server error",
+			opts:         githubtest.Options{ServerErrorEvery: 2},
+			users:        2,
+			wantRequests: 3,
+			wantTokens:   1,
+		},
+		{
+			name:         "secondary rate limit",
+			opts:         githubtest.Options{SecondaryRateLimitEvery: 2},
+			users:        2,
+			wantRequests: 3,
+			wantTokens:   1,
+		},
+		{
+			name:         "primary rate limit waits for the reset",
+			opts:         githubtest.Options{PrimaryRateLimitEvery: 2},
+			users:        2,
+			wantRequests: 3,
+			wantTokens:   1,
+		},
+		{
+			name:         "primary rate limit rotates to another token",
+			opts:         githubtest.Options{PrimaryRateLimitEvery: 2},
+			extraTokens:  []string{"second"},
+			users:        2,
+			wantRequests: 3,
+			wantTokens:   2,
+		},
+		{
+			name:         "gone user is not retried",
+			opts:         githubtest.Options{GoneEvery: 1},
+			users:        1,
+			wantRequests: 1,
+			wantGone:     true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.opts.Enterprise = "test"
+			srv := githubtest.NewServer(tt.opts)
+			defer srv.Close()
+			c := github.NewClient("token", zap.NewNop(), github.WithBaseURL(srv.URL), github.WithTokens(tt.extraTokens...))
+
+			for i := range tt.users {
+				_, err := c.GetUsage(context.Background(), "test", srv.Login(i))
+				if tt.wantGone {
+					if !github.IsUserGone(err) {
+						t.Errorf("usage of %s: got %v, want the user gone", srv.Login(i), err)
+					}
+				} else if err != nil {
+					t.Fatalf("usage of %s: %v", srv.Login(i), err)
+				}
+			}
+
+			if got := srv.Requests(); got != tt.wantRequests {
+				t.Errorf("served %d requests, want %d", got, tt.wantRequests)
+			}
+			used := 0
+			for _, tok := range c.Stats().Tokens {
+				if tok.Requests > 0 {
+					used++
+				}
+			}
+			if tt.wantTokens > 0 && used != tt.wantTokens {
+				t.Errorf("used %d tokens, want %d", used, tt.wantTokens)
+			}
+		})
+	}
+}
+
+// TestMemberOrganizationsPaged follows the organizations of a member in more
+// organizations than fit in the members query.
+func TestMemberOrganizationsPaged(t *testing.T) {
+	orgs := func(logins ...string) []map[string]string {
+		var nodes []map[string]string
+		for _, login := range logins {
+			nodes = append(nodes, map[string]string{"login": login})
+		}
+		return nodes
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var data any
+		switch {
+		case strings.Contains(req.Query, "externalIdentities"):
+			data = map[string]any{"enterprise": map[string]any{"ownerInfo": map[string]any{"samlIdentityProvider": nil}}}
+		case strings.Contains(req.Query, "members"):
+			data = map[string]any{"enterprise": map[string]any{"members": map[string]any{
+				"pageInfo": map[string]any{"hasNextPage": false},
+				"nodes": []any{map[string]any{"id": "EUA_alice", "login": "alice", "organizations": map[string]any{
+					"pageInfo": map[string]any{"hasNextPage": true, "endCursor": "1"},
+					"nodes":    orgs("one"),
+				}}},
+			}}}
+		case req.Variables["id"] == "EUA_alice" && req.Variables["cursor"] == "1":
+			data = map[string]any{"node": map[string]any{"organizations": map[string]any{
+				"pageInfo": map[string]any{"hasNextPage": true, "endCursor": "2"},
+				"nodes":    orgs("two"),
+			}}}
+		case req.Variables["id"] == "EUA_alice" && req.Variables["cursor"] == "2":
+			data = map[string]any{"node": map[string]any{"organizations": map[string]any{
+				"pageInfo": map[string]any{"hasNextPage": false},
+				"nodes":    orgs("three"),
+			}}}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer srv.Close()
+	c := github.NewClient("token", zap.NewNop(), github.WithBaseURL(srv.URL))
+
+	identities, err := c.ListEnterpriseIdentities(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := identities["alice"].Organizations, []string{"one", "two", "three"}; !slices.Equal(got, want) {
+		t.Errorf("organizations = %v, want %v", got, want)
+	}
+}
+
+func TestPreflightUnknownEnterprise(t *testing.T) {
+	srv := githubtest.NewServer(githubtest.Options{Enterprise: "test"})
+	defer srv.Close()
+	c := github.NewClient("token", zap.NewNop(), github.WithBaseURL(srv.URL))
+
+	err := c.Preflight(context.Background(), "other")
+	if err == nil || !strings.Contains(err.Error(), `"other"`) || !strings.Contains(err.Error(), srv.URL) {
+		t.Errorf("got %v, want an error naming the slug and the host", err)
+	}
+}
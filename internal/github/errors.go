@@ -0,0 +1,82 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	ErrorClassRateLimited = "rate_limited"
+	ErrorClassNotFound    = "not_found"
+	ErrorClassDecode      = "decode_error"
+	ErrorClassStatus      = "unexpected_status"
+	ErrorClassOther       = "other"
+)
+
+// StatusError is returned when GitHub answers with a status the client does
+// not handle.
+type StatusError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d for %s", e.StatusCode, e.URL)
+}
+
+// RateLimitError is returned once the client has given up waiting out a
+// primary or secondary rate limit.
+type RateLimitError struct {
+	Secondary bool
+	URL       string
+	Retries   int
+}
+
+func (e *RateLimitError) Error() string {
+	kind := "primary"
+	if e.Secondary {
+		kind = "secondary"
+	}
+	return fmt.Sprintf("%s rate limited on %s after %d retries", kind, e.URL, e.Retries)
+}
+
+// DecodeError is returned when a successful response body cannot be decoded.
+type DecodeError struct {
+	URL string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding response from %s: %v", e.URL, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// ErrorClass maps an error returned by the client to a short, stable class
+// suitable for use as a metric label.
+func ErrorClass(err error) string {
+	var rateLimitErr *RateLimitError
+	var decodeErr *DecodeError
+	var statusErr *StatusError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		return ErrorClassRateLimited
+	case errors.As(err, &decodeErr):
+		return ErrorClassDecode
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		return ErrorClassNotFound
+	case errors.As(err, &statusErr):
+		return ErrorClassStatus
+	default:
+		return ErrorClassOther
+	}
+}
+
+// IsUserGone reports whether err is GitHub answering 404 or 422 for a user's
+// usage, as it does for a user deprovisioned since the seats were listed.
+func IsUserGone(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) &&
+		(statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusUnprocessableEntity)
+}
@@ -0,0 +1,429 @@
+// Package githubtest provides a fake GitHub API serving synthetic Copilot
+// seats and premium request usage. It backs the exporter's demo mode and can
+// be used by integration tests to exercise pagination and rate-limit paths.
+package githubtest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/github"
+)
+
+const defaultPerPage = 50
+const rateLimit = 5000
+
+var models = []string{"Claude Sonnet 4", "GPT-5", "Gemini 2.5 Pro", "o3"}
+var organizations = []string{"demo-platform", "demo-data", "demo-web"}
+var teams = []string{"copilot-platform", "copilot-data", "copilot-web", "copilot-mobile"}
+
+type Options struct {
+	Enterprise string
+	Seats      int
+	// IncludedRequests is the monthly premium request allowance applied as a
+	// discount before any usage becomes billable.
+	IncludedRequests float64
+	// PrimaryRateLimitEvery makes every Nth request fail with a 403 and an
+	// exhausted X-RateLimit-Remaining. Zero disables it.
+	PrimaryRateLimitEvery int
+	// SecondaryRateLimitEvery makes every Nth request fail with a 429 and a
+	// Retry-After header. Zero disables it.
+	SecondaryRateLimitEvery int
+	// ServerErrorEvery makes every Nth request fail with a 502. Zero disables
+	// it.
+	ServerErrorEvery int
+	// GoneEvery makes the usage of every Nth seat holder answer 404, as for
+	// users removed after the seats were listed. Zero disables it.
+	GoneEvery int
+}
+
+type Server struct {
+	*httptest.Server
+	opts Options
+
+	mu        sync.Mutex
+	requests  int
+	remaining int
+	reset     time.Time
+}
+
+// NewServer starts a fake GitHub API on a loopback port. Callers must Close it.
+func NewServer(opts Options) *Server {
+	if opts.Enterprise == "" {
+		opts.Enterprise = "demo"
+	}
+	if opts.Seats == 0 {
+		opts.Seats = 100
+	}
+	if opts.IncludedRequests == 0 {
+		opts.IncludedRequests = 300
+	}
+
+	s := &Server{opts: opts, remaining: rateLimit, reset: time.Now().Add(time.Hour)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /enterprises/{enterprise}/copilot/billing/seats", s.handleSeats)
+	mux.HandleFunc("GET /enterprises/{enterprise}/settings/billing/premium_request/usage", s.handleUsage)
+	mux.HandleFunc("POST /graphql", s.handleGraphQL)
+	mux.HandleFunc("GET /rate_limit", s.handleRateLimit)
+	mux.HandleFunc("GET /enterprises/{enterprise}/settings/billing/usage", s.handleBillingUsage)
+	mux.HandleFunc("GET /enterprises/{enterprise}/settings/billing/advanced-security", s.handleAdvancedSecurity)
+	s.Server = httptest.NewServer(s.rateLimited(gzipped(mux)))
+	return s
+}
+
+// Requests returns the number of requests served so far, including those
+// rejected by simulated rate limits.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) Login(i int) string {
+	return fmt.Sprintf("demo-user-%04d", i+1)
+}
+
+func (s *Server) rateLimited(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		n := s.requests
+		w.Header().Set("X-GitHub-Request-Id", fmt.Sprintf("DEMO:%08X", n))
+		if time.Now().After(s.reset) {
+			s.remaining = rateLimit
+			s.reset = time.Now().Add(time.Hour)
+		}
+		primary := s.opts.PrimaryRateLimitEvery > 0 && n%s.opts.PrimaryRateLimitEvery == 0
+		secondary := s.opts.SecondaryRateLimitEvery > 0 && n%s.opts.SecondaryRateLimitEvery == 0
+		serverError := s.opts.ServerErrorEvery > 0 && n%s.opts.ServerErrorEvery == 0
+		if !primary && !secondary && !serverError && s.remaining > 0 {
+			s.remaining--
+		}
+		remaining, reset := s.remaining, s.reset
+		s.mu.Unlock()
+
+		switch {
+		case primary:
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Second).Unix(), 10))
+			http.Error(w, `{"message":"API rate limit exceeded"}`, http.StatusForbidden)
+			return
+		case secondary:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, `{"message":"You have exceeded a secondary rate limit"}`, http.StatusTooManyRequests)
+			return
+		case serverError:
+			http.Error(w, `{"message":"Server Error"}`, http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rateLimit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		resource := "core"
+		if r.URL.Path == "/graphql" {
+			resource = "graphql"
+		}
+		w.Header().Set("X-RateLimit-Resource", resource)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleRateLimit(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	core := map[string]any{"limit": rateLimit, "remaining": s.remaining, "reset": s.reset.Unix()}
+	s.mu.Unlock()
+	w.Header().Set("X-OAuth-Scopes", "manage_billing:copilot, read:org")
+	writeJSON(w, map[string]any{"resources": map[string]any{"core": core}})
+}
+
+func (s *Server) handleSeats(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("enterprise") != s.opts.Enterprise {
+		http.NotFound(w, r)
+		return
+	}
+
+	perPage := queryInt(r, "per_page", defaultPerPage)
+	page := queryInt(r, "page", 1)
+
+	resp := github.SeatsResponse{TotalSeats: s.opts.Seats, Seats: []github.CopilotSeat{}}
+	for i := (page - 1) * perPage; i < page*perPage && i < s.opts.Seats; i++ {
+		seat := github.CopilotSeat{Assignee: github.Assignee{Login: s.Login(i), Type: "User"}, PlanType: "business"}
+		if i%50 == 49 {
+			seat.Assignee.Type = "Bot"
+		}
+		if i%4 != 0 {
+			team := teams[i%len(teams)]
+			seat.AssigningTeam = &github.Team{Slug: team, Name: team}
+		}
+		resp.Seats = append(resp.Seats, seat)
+	}
+
+	setLinks(w, r, page, (s.opts.Seats+perPage-1)/perPage)
+	writeJSON(w, resp)
+}
+
+// setLinks writes a Link header pointing at the next and last pages the way
+// GitHub does, keeping every other query parameter.
+func setLinks(w http.ResponseWriter, r *http.Request, page, lastPage int) {
+	pageURL := func(n int) string {
+		q := r.URL.Query()
+		q.Set("page", strconv.Itoa(n))
+		u := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path, RawQuery: q.Encode()}
+		return u.String()
+	}
+	var links []string
+	if page < lastPage {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(page+1)))
+	}
+	if lastPage > 0 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="last"`, pageURL(lastPage)))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("enterprise") != s.opts.Enterprise {
+		http.NotFound(w, r)
+		return
+	}
+
+	user := r.URL.Query().Get("user")
+	if n := s.opts.GoneEvery; n > 0 {
+		var i int
+		if _, err := fmt.Sscanf(user, "demo-user-%d", &i); err == nil && i%n == 0 {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	writeJSON(w, github.UsageResponse{
+		Enterprise: s.opts.Enterprise,
+		User:       user,
+		UsageItems: s.usageItems(user),
+	})
+}
+
+// handleBillingUsage reports a day of Actions minutes and Packages storage
+// and transfer per synthetic organization for every day of the requested
+// month up to today.
+func (s *Server) handleBillingUsage(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("enterprise") != s.opts.Enterprise {
+		http.NotFound(w, r)
+		return
+	}
+
+	now := time.Now().UTC()
+	year := queryInt(r, "year", now.Year())
+	month := time.Month(queryInt(r, "month", int(now.Month())))
+	skus := []struct {
+		product, sku, unit string
+		price              float64
+	}{
+		{"actions", "actions_linux", "minutes", 0.008},
+		{"actions", "actions_windows", "minutes", 0.016},
+		{"packages", "packages_storage", "gigabyte-hours", 0.00033},
+		{"packages", "packages_data_transfer", "gigabytes", 0.5},
+	}
+
+	items := []github.BillingUsageItem{}
+	for day := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC); day.Month() == month && !day.After(now); day = day.AddDate(0, 0, 1) {
+		for i, org := range organizations {
+			for j, sku := range skus {
+				qty := float64((day.Day()*7+i*13+j*31)%50 + 10)
+				items = append(items, github.BillingUsageItem{
+					Date:             day.Format(time.DateOnly),
+					Product:          sku.product,
+					SKU:              sku.sku,
+					Quantity:         qty,
+					UnitType:         sku.unit,
+					PricePerUnit:     sku.price,
+					GrossAmount:      qty * sku.price,
+					NetAmount:        qty * sku.price,
+					OrganizationName: org,
+				})
+			}
+		}
+	}
+	writeJSON(w, github.BillingUsageResponse{UsageItems: items})
+}
+
+func (s *Server) handleAdvancedSecurity(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("enterprise") != s.opts.Enterprise {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, github.AdvancedSecurityCommitters{
+		Total:     s.opts.Seats / 3,
+		Maximum:   s.opts.Seats / 2,
+		Purchased: s.opts.Seats / 2,
+	})
+}
+
+// usageItems derives stable, plausible usage from the login so repeated
+// cycles report the same numbers.
+func (s *Server) usageItems(user string) []github.UsageItem {
+	h := fnv.New64a()
+	h.Write([]byte(user))
+	seed := h.Sum64()
+
+	const price = 0.04
+	allowance := s.opts.IncludedRequests
+	var items []github.UsageItem
+	for i, model := range models {
+		if seed>>(i*8)&0x3 == 0 {
+			continue
+		}
+		qty := float64(seed >> (i * 8) & 0xff)
+		discount := min(qty, allowance)
+		allowance -= discount
+		items = append(items, github.UsageItem{
+			Product:          "copilot",
+			SKU:              "copilot_premium_request",
+			Model:            model,
+			UnitType:         "requests",
+			PricePerUnit:     price,
+			GrossQuantity:    qty,
+			GrossAmount:      qty * price,
+			DiscountQuantity: discount,
+			DiscountAmount:   discount * price,
+			NetQuantity:      qty - discount,
+			NetAmount:        (qty - discount) * price,
+		})
+	}
+	return items
+}
+
+// Organizations returns the synthetic organizations the user at index i
+// belongs to.
+func (s *Server) Organizations(i int) []string {
+	orgs := []string{organizations[i%len(organizations)]}
+	if i%5 == 0 {
+		orgs = append(orgs, organizations[(i+1)%len(organizations)])
+	}
+	return orgs
+}
+
+// handleGraphQL answers the identity and membership queries issued by
+// github.Client.ListEnterpriseIdentities. It dispatches on the query text
+// rather than parsing GraphQL.
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query     string `json:"query"`
+		Variables struct {
+			Enterprise string  `json:"enterprise"`
+			Cursor     *string `json:"cursor"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Variables.Enterprise != s.opts.Enterprise {
+		writeJSON(w, map[string]any{"data": map[string]any{"enterprise": nil}})
+		return
+	}
+
+	const pageSize = 100
+	first := 0
+	if req.Variables.Cursor != nil {
+		first, _ = strconv.Atoi(*req.Variables.Cursor)
+	}
+	last := min(first+pageSize, s.opts.Seats)
+	page := map[string]any{
+		"hasNextPage": last < s.opts.Seats,
+		"endCursor":   strconv.Itoa(last),
+	}
+
+	var nodes []map[string]any
+	var enterprise map[string]any
+	switch {
+	case strings.Contains(req.Query, "externalIdentities"):
+		for i := first; i < last; i++ {
+			login := s.Login(i)
+			email := login + "@demo.example"
+			nodes = append(nodes, map[string]any{
+				"user": map[string]any{"login": login},
+				"samlIdentity": map[string]any{
+					"nameId": email,
+					"emails": []map[string]any{{"value": email}},
+					"attributes": []map[string]any{
+						{"name": "employeeNumber", "value": fmt.Sprintf("E%05d", i+1)},
+					},
+				},
+				"scimIdentity": nil,
+			})
+		}
+		enterprise = map[string]any{"ownerInfo": map[string]any{"samlIdentityProvider": map[string]any{
+			"externalIdentities": map[string]any{"pageInfo": page, "nodes": nodes},
+		}}}
+	case strings.Contains(req.Query, "members"):
+		for i := first; i < last; i++ {
+			var orgs []map[string]any
+			for _, org := range s.Organizations(i) {
+				orgs = append(orgs, map[string]any{"login": org})
+			}
+			nodes = append(nodes, map[string]any{
+				"id":    "EUA_" + s.Login(i),
+				"login": s.Login(i),
+				"organizations": map[string]any{
+					"pageInfo": map[string]any{"hasNextPage": false, "endCursor": nil},
+					"nodes":    orgs,
+				},
+			})
+		}
+		enterprise = map[string]any{"members": map[string]any{"pageInfo": page, "nodes": nodes}}
+	default:
+		writeJSON(w, map[string]any{"errors": []map[string]any{{"message": "unsupported query"}}})
+		return
+	}
+
+	writeJSON(w, map[string]any{"data": map[string]any{"enterprise": enterprise}})
+}
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (w gzipResponseWriter) Write(b []byte) (int, error) {
+	return w.gz.Write(b)
+}
+
+// gzipped compresses responses for clients that accept it, as GitHub does.
+func gzipped(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Add("Vary", "Accept-Encoding")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		next.ServeHTTP(gzipResponseWriter{ResponseWriter: w, gz: gz}, r)
+	})
+}
+
+func queryInt(r *http.Request, key string, def int) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get(key)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,292 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const graphqlResource = "graphql"
+
+// Identity is what the enterprise knows about a GitHub login beyond the login
+// itself: its SAML/SCIM identity and the organizations it belongs to.
+type Identity struct {
+	Login         string
+	NameID        string
+	Email         string
+	Attributes    map[string]string
+	Organizations []string
+}
+
+type graphqlRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// GraphQLError is returned when GitHub answers a GraphQL query with errors.
+type GraphQLError struct {
+	Messages []string
+}
+
+func (e *GraphQLError) Error() string {
+	return "graphql: " + strings.Join(e.Messages, "; ")
+}
+
+type pageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+// graphqlURL derives the GraphQL endpoint from the REST base: GitHub Enterprise
+// Server serves REST under /api/v3 and GraphQL under /api/graphql, everything
+// else serves GraphQL at /graphql on the API host.
+func (c *Client) graphqlURL() string {
+	if base, ok := strings.CutSuffix(c.apiBase, "/api/v3"); ok {
+		return base + "/api/graphql"
+	}
+	return c.apiBase + "/graphql"
+}
+
+func (c *Client) graphql(ctx context.Context, query string, vars map[string]any, out any) error {
+	body, err := json.Marshal(graphqlRequest{Query: query, Variables: vars})
+	if err != nil {
+		return err
+	}
+
+	var resp graphqlResponse
+	if _, err := c.do(ctx, endpointGraphQL, http.MethodPost, c.graphqlURL(), body, graphqlResource, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		gqlErr := &GraphQLError{}
+		for _, e := range resp.Errors {
+			gqlErr.Messages = append(gqlErr.Messages, e.Message)
+		}
+		return gqlErr
+	}
+	if err := json.Unmarshal(resp.Data, out); err != nil {
+		return &DecodeError{URL: c.graphqlURL(), Err: err}
+	}
+	return nil
+}
+
+const externalIdentitiesQuery = `query($enterprise: String!, $cursor: String) {
+  enterprise(slug: $enterprise) {
+    ownerInfo {
+      samlIdentityProvider {
+        externalIdentities(first: 100, after: $cursor) {
+          pageInfo { hasNextPage endCursor }
+          nodes {
+            user { login }
+            samlIdentity { nameId emails { value } attributes { name value } }
+            scimIdentity { emails { value primary } }
+          }
+        }
+      }
+    }
+  }
+}`
+
+type externalIdentitiesData struct {
+	Enterprise *struct {
+		OwnerInfo struct {
+			SAMLIdentityProvider *struct {
+				ExternalIdentities struct {
+					PageInfo pageInfo `json:"pageInfo"`
+					Nodes    []struct {
+						User *struct {
+							Login string `json:"login"`
+						} `json:"user"`
+						SAMLIdentity *struct {
+							NameID string `json:"nameId"`
+							Emails []struct {
+								Value string `json:"value"`
+							} `json:"emails"`
+							Attributes []struct {
+								Name  string `json:"name"`
+								Value string `json:"value"`
+							} `json:"attributes"`
+						} `json:"samlIdentity"`
+						SCIMIdentity *struct {
+							Emails []struct {
+								Value   string `json:"value"`
+								Primary bool   `json:"primary"`
+							} `json:"emails"`
+						} `json:"scimIdentity"`
+					} `json:"nodes"`
+				} `json:"externalIdentities"`
+			} `json:"samlIdentityProvider"`
+		} `json:"ownerInfo"`
+	} `json:"enterprise"`
+}
+
+const memberOrganizationsQuery = `query($enterprise: String!, $cursor: String) {
+  enterprise(slug: $enterprise) {
+    members(first: 100, after: $cursor) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        ... on EnterpriseUserAccount {
+          id
+          login
+          organizations(first: 100) {
+            pageInfo { hasNextPage endCursor }
+            nodes { login }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// moreOrganizationsQuery pages through the organizations of a member in
+// more than the 100 that memberOrganizationsQuery returns.
+const moreOrganizationsQuery = `query($id: ID!, $cursor: String) {
+  node(id: $id) {
+    ... on EnterpriseUserAccount {
+      organizations(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes { login }
+      }
+    }
+  }
+}`
+
+type organizationConnection struct {
+	PageInfo pageInfo `json:"pageInfo"`
+	Nodes    []struct {
+		Login string `json:"login"`
+	} `json:"nodes"`
+}
+
+type memberOrganizationsData struct {
+	Enterprise *struct {
+		Members struct {
+			PageInfo pageInfo `json:"pageInfo"`
+			Nodes    []struct {
+				ID            string                 `json:"id"`
+				Login         string                 `json:"login"`
+				Organizations organizationConnection `json:"organizations"`
+			} `json:"nodes"`
+		} `json:"members"`
+	} `json:"enterprise"`
+}
+
+type moreOrganizationsData struct {
+	Node *struct {
+		Organizations organizationConnection `json:"organizations"`
+	} `json:"node"`
+}
+
+// ListEnterpriseIdentities fetches the SAML/SCIM identity and organization
+// memberships of every enterprise member in batches of 100, keyed by login.
+// Enterprises without a SAML identity provider yield identities that only
+// carry organizations.
+func (c *Client) ListEnterpriseIdentities(ctx context.Context, enterprise string) (map[string]*Identity, error) {
+	identities := make(map[string]*Identity)
+	lookup := func(login string) *Identity {
+		id, ok := identities[login]
+		if !ok {
+			id = &Identity{Login: login}
+			identities[login] = id
+		}
+		return id
+	}
+
+	vars := map[string]any{"enterprise": enterprise, "cursor": nil}
+	for {
+		var data externalIdentitiesData
+		if err := c.graphql(ctx, externalIdentitiesQuery, vars, &data); err != nil {
+			return nil, fmt.Errorf("listing external identities: %w", err)
+		}
+		if data.Enterprise == nil {
+			return nil, fmt.Errorf("enterprise %q not found", enterprise)
+		}
+		idp := data.Enterprise.OwnerInfo.SAMLIdentityProvider
+		if idp == nil {
+			break
+		}
+
+		for _, node := range idp.ExternalIdentities.Nodes {
+			if node.User == nil {
+				continue
+			}
+			id := lookup(node.User.Login)
+			if saml := node.SAMLIdentity; saml != nil {
+				id.NameID = saml.NameID
+				if len(saml.Emails) > 0 {
+					id.Email = saml.Emails[0].Value
+				}
+				for _, attr := range saml.Attributes {
+					if id.Attributes == nil {
+						id.Attributes = make(map[string]string)
+					}
+					id.Attributes[attr.Name] = attr.Value
+				}
+			}
+			if scim := node.SCIMIdentity; scim != nil {
+				for _, email := range scim.Emails {
+					if email.Primary || id.Email == "" {
+						id.Email = email.Value
+					}
+				}
+			}
+		}
+
+		if !idp.ExternalIdentities.PageInfo.HasNextPage {
+			break
+		}
+		vars["cursor"] = idp.ExternalIdentities.PageInfo.EndCursor
+	}
+
+	vars["cursor"] = nil
+	for {
+		var data memberOrganizationsData
+		if err := c.graphql(ctx, memberOrganizationsQuery, vars, &data); err != nil {
+			return nil, fmt.Errorf("listing member organizations: %w", err)
+		}
+		if data.Enterprise == nil {
+			return nil, fmt.Errorf("enterprise %q not found", enterprise)
+		}
+
+		for _, node := range data.Enterprise.Members.Nodes {
+			if node.Login == "" {
+				continue
+			}
+			id := lookup(node.Login)
+			for orgs := node.Organizations; ; {
+				for _, org := range orgs.Nodes {
+					id.Organizations = append(id.Organizations, org.Login)
+				}
+				if !orgs.PageInfo.HasNextPage {
+					break
+				}
+				var more moreOrganizationsData
+				orgVars := map[string]any{"id": node.ID, "cursor": orgs.PageInfo.EndCursor}
+				if err := c.graphql(ctx, moreOrganizationsQuery, orgVars, &more); err != nil {
+					return nil, fmt.Errorf("listing organizations of %s: %w", node.Login, err)
+				}
+				if more.Node == nil {
+					return nil, fmt.Errorf("listing organizations of %s: member not found", node.Login)
+				}
+				orgs = more.Node.Organizations
+			}
+		}
+
+		if !data.Enterprise.Members.PageInfo.HasNextPage {
+			break
+		}
+		vars["cursor"] = data.Enterprise.Members.PageInfo.EndCursor
+	}
+
+	return identities, nil
+}
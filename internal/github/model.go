@@ -6,11 +6,28 @@ type SeatsResponse struct {
 }
 
 type CopilotSeat struct {
-	Assignee Assignee `json:"assignee"`
+	Assignee      Assignee `json:"assignee"`
+	AssigningTeam *Team    `json:"assigning_team,omitempty"`
+	PlanType      string   `json:"plan_type,omitempty"`
+}
+
+type Team struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// AssigningTeamSlug returns the slug of the team the seat was assigned
+// through, or "" for seats assigned directly to the user.
+func (s CopilotSeat) AssigningTeamSlug() string {
+	if s.AssigningTeam == nil {
+		return ""
+	}
+	return s.AssigningTeam.Slug
 }
 
 type Assignee struct {
 	Login string `json:"login"`
+	Type  string `json:"type"`
 }
 
 type UsageResponse struct {
@@ -0,0 +1,83 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// copilotBillingScopes are the classic token scopes any one of which lets a
+// token read an enterprise's Copilot seats and premium request usage.
+var copilotBillingScopes = []string{"manage_billing:copilot", "manage_billing:enterprise", "read:enterprise", "admin:enterprise"}
+
+// Preflight checks that every configured token is accepted by GitHub and
+// carries a scope for reading Copilot billing, and that enterprise exists and
+// is visible to the client. Its errors say what to fix.
+func (c *Client) Preflight(ctx context.Context, enterprise string) error {
+	for _, t := range c.tokens.tokens {
+		if err := c.checkToken(ctx, t); err != nil {
+			return err
+		}
+	}
+
+	url := fmt.Sprintf("%s/enterprises/%s/copilot/billing/seats?per_page=1", c.apiBase, enterprise)
+	var resp SeatsResponse
+	if err := c.get(ctx, endpointSeats, url, &resp); err != nil {
+		var statusErr *StatusError
+		switch {
+		case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+			return fmt.Errorf("enterprise %q not found at %s: check it is the enterprise slug and the token's owner is an enterprise owner or billing manager", enterprise, c.apiBase)
+		case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusForbidden:
+			return fmt.Errorf("token may not read copilot billing for enterprise %q: grant the token's owner enterprise owner or billing manager access", enterprise)
+		}
+		return fmt.Errorf("checking copilot billing access for enterprise %q: %w", enterprise, err)
+	}
+	return nil
+}
+
+// checkToken calls /rate_limit, which does not count against the rate limit,
+// with t directly rather than through the pool.
+func (c *Client) checkToken(ctx context.Context, t *token) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiBase+"/rate_limit", nil)
+	if err != nil {
+		return err
+	}
+	c.setHeaders(req, t)
+
+	resp, err := c.send(req, endpointRateLimit)
+	if err != nil {
+		return fmt.Errorf("checking %s: %w", t.name, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	c.updateRateLimit(t, resp)
+	c.updateExpiration(ctx, t, resp)
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("github rejected %s: check the token is valid and has not expired", t.name)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("checking %s: unexpected status %d from /rate_limit", t.name, resp.StatusCode)
+	}
+
+	// Fine-grained and GitHub App tokens carry no scopes header; only classic
+	// tokens can be checked here.
+	if _, ok := resp.Header["X-Oauth-Scopes"]; !ok {
+		return nil
+	}
+	var scopes []string
+	for _, s := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	if !slices.ContainsFunc(scopes, func(s string) bool { return slices.Contains(copilotBillingScopes, s) }) {
+		return fmt.Errorf("%s has scopes [%s] but needs one of [%s] to read copilot billing",
+			t.name, strings.Join(scopes, ", "), strings.Join(copilotBillingScopes, ", "))
+	}
+	return nil
+}
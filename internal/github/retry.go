@@ -0,0 +1,55 @@
+package github
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+const maxServerErrorRetries = 3
+const maxNetworkErrorRetries = 3
+const retryBaseDelay = time.Second
+const retryMaxDelay = 30 * time.Second
+
+// backoff returns the delay before retry number n (starting at 1): doubling
+// from retryBaseDelay up to retryMaxDelay, with up to half of it added as
+// jitter so concurrent exporters do not retry in lockstep.
+func backoff(n int) time.Duration {
+	d := min(retryBaseDelay<<(n-1), retryMaxDelay)
+	return d + rand.N(d/2+1)
+}
+
+// retryableNetworkError reports whether err from sending a request is likely
+// to go away on its own: timeouts, DNS failures, refused or reset connections
+// and connections closed mid-response. Certificate and TLS handshake failures
+// are configuration problems and are never retried.
+func retryableNetworkError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalidCert x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &certErr) || errors.As(err, &unknownAuthority) || errors.As(err, &invalidCert) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &recordErr) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EPIPE):
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	return false
+}
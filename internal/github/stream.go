@@ -0,0 +1,77 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// streamDecoder is implemented by responses that decode themselves element by
+// element, so the decoder only ever buffers one element of a large array
+// instead of the whole body.
+type streamDecoder interface {
+	decodeFrom(dec *json.Decoder) error
+}
+
+func (r *SeatsResponse) decodeFrom(dec *json.Decoder) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case "total_seats":
+			err = dec.Decode(&r.TotalSeats)
+		case "seats":
+			err = decodeArray(dec, func() error {
+				var seat CopilotSeat
+				if err := dec.Decode(&seat); err != nil {
+					return err
+				}
+				r.Seats = append(r.Seats, seat)
+				return nil
+			})
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// decodeArray calls each for every element of the array at the decoder's
+// position, or not at all for null.
+func decodeArray(dec *json.Decoder, each func() error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("expected array, got %v", tok)
+	}
+	for dec.More() {
+		if err := each(); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("expected %v, got %v", want, tok)
+	}
+	return nil
+}
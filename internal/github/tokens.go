@@ -0,0 +1,154 @@
+package github
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const coreResource = "core"
+
+type rateLimit struct {
+	remaining int
+	reset     time.Time
+}
+
+type token struct {
+	name     string
+	value    string
+	requests int64
+	limits   map[string]rateLimit
+	// expiryWarned is when the client last warned that the token expires
+	// soon.
+	expiryWarned time.Time
+}
+
+// tokenPool spreads requests across one or more tokens, always picking the one
+// with the most rate limit left for the resource being called. Tokens are
+// identified in logs and metrics by their position ("token1", "token2", …),
+// never by their value.
+type tokenPool struct {
+	mu     sync.Mutex
+	tokens []*token
+}
+
+func newTokenPool(values []string) *tokenPool {
+	p := &tokenPool{}
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		p.tokens = append(p.tokens, &token{
+			name:   fmt.Sprintf("token%d", len(p.tokens)+1),
+			value:  v,
+			limits: make(map[string]rateLimit),
+		})
+	}
+	if len(p.tokens) == 0 {
+		p.tokens = append(p.tokens, &token{name: "token1", limits: make(map[string]rateLimit)})
+	}
+	return p
+}
+
+// headroom is how many requests t can still make against resource. Tokens
+// whose window is unknown or has already reset are treated as unlimited.
+func (t *token) headroom(resource string, now time.Time) int {
+	l, ok := t.limits[resource]
+	if !ok || l.remaining < 0 || now.After(l.reset) {
+		return math.MaxInt
+	}
+	return l.remaining
+}
+
+// acquire returns the token with the most headroom for resource. When every
+// token is exhausted it returns the one that resets first along with how long
+// to wait for that reset.
+func (p *tokenPool) acquire(resource string) (*token, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	best, bestHeadroom := p.tokens[0], -1
+	for _, t := range p.tokens {
+		if h := t.headroom(resource, now); h > bestHeadroom {
+			best, bestHeadroom = t, h
+		}
+	}
+	if bestHeadroom > 0 {
+		best.requests++
+		return best, 0
+	}
+
+	for _, t := range p.tokens {
+		if t.limits[resource].reset.Before(best.limits[resource].reset) {
+			best = t
+		}
+	}
+	best.requests++
+	return best, time.Until(best.limits[resource].reset) + rateLimitResetBuffer
+}
+
+func (p *tokenPool) size() int {
+	return len(p.tokens)
+}
+
+// availableBesides reports whether any token other than t still has headroom
+// for resource.
+func (p *tokenPool) availableBesides(t *token, resource string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for _, other := range p.tokens {
+		if other != t && other.headroom(resource, now) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *tokenPool) update(t *token, resource string, remaining int, reset time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l := t.limits[resource]
+	if remaining >= 0 {
+		l.remaining = remaining
+	}
+	if !reset.IsZero() {
+		l.reset = reset
+	}
+	t.limits[resource] = l
+}
+
+// warnExpiry reports whether it is time to warn again that t expires soon,
+// recording that it was.
+func (p *tokenPool) warnExpiry(t *token, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now.Sub(t.expiryWarned) < 24*time.Hour {
+		return false
+	}
+	t.expiryWarned = now
+	return true
+}
+
+func (p *tokenPool) stats() []TokenStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]TokenStats, 0, len(p.tokens))
+	for _, t := range p.tokens {
+		s := TokenStats{Name: t.name, Requests: t.requests, RateLimitRemaining: -1}
+		if l, ok := t.limits[coreResource]; ok {
+			s.RateLimitRemaining = l.remaining
+			s.RateLimitReset = l.reset
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
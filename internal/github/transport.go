@@ -0,0 +1,54 @@
+package github
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// TransportConfig tunes connection reuse towards the GitHub API. Zero values
+// take the defaults below.
+type TransportConfig struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	DisableHTTP2        bool
+}
+
+const defaultMaxIdleConns = 100
+
+// A cycle makes thousands of requests to the same host, so keep more than
+// net/http's default of two idle connections around for it.
+const defaultMaxIdleConnsPerHost = 16
+const defaultIdleConnTimeout = 90 * time.Second
+
+func newTransport(conf TransportConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = defaultMaxIdleConns
+	if conf.MaxIdleConns > 0 {
+		t.MaxIdleConns = conf.MaxIdleConns
+	}
+	t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	if conf.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = conf.MaxIdleConnsPerHost
+	}
+	t.IdleConnTimeout = defaultIdleConnTimeout
+	if conf.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = conf.IdleConnTimeout
+	}
+	if conf.DisableHTTP2 {
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	// The transport sends Accept-Encoding: gzip and transparently decompresses
+	// the response as long as requests do not set Accept-Encoding themselves.
+	t.DisableCompression = false
+	return t
+}
+
+// WithTransport replaces the default connection settings.
+func WithTransport(conf TransportConfig) Option {
+	return func(c *Client) {
+		c.httpClient.Transport = newTransport(conf)
+	}
+}
@@ -0,0 +1,24 @@
+// Package logctx carries a request- or cycle-scoped logger in a context, so
+// code called deep inside a collection cycle logs with the cycle's fields.
+package logctx
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type key struct{}
+
+// With returns a copy of ctx carrying logger.
+func With(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, key{}, logger)
+}
+
+// From returns the logger carried by ctx, or fallback if there is none.
+func From(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if logger, ok := ctx.Value(key{}).(*zap.Logger); ok {
+		return logger
+	}
+	return fallback
+}
@@ -1,23 +1,619 @@
 package internal
 
 import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var labels = []string{"user", "sku", "model", "enterprise"}
+var baseLabels = []string{"user", "sku", "model", "enterprise"}
+var labels []string
+
+// BuildInfo is set once at startup, so each series can be traced back to the
+// exporter build that produced it.
+var BuildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "copilot_premium_usage_exporter_build_info",
+	Help: "Always 1, labelled with the exporter's version, VCS commit and the Go version it was built with",
+}, []string{"version", "commit", "go_version"})
+
+// GitHub API metrics are independent of the configured namespace, so they
+// exist from package init and the client can update them before Register is
+// called.
+var RateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "github_api_rate_limit_remaining",
+	Help: "Requests remaining in the current GitHub API rate limit window per token and resource",
+}, []string{"token", "resource"})
+
+var RateLimitReset = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "github_api_rate_limit_reset_timestamp",
+	Help: "Unix time at which the current GitHub API rate limit window resets per token and resource",
+}, []string{"token", "resource"})
+
+var TokenExpiration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "github_token_expiration_timestamp",
+	Help: "Unix time at which the token expires, as reported by GitHub for tokens with an expiry",
+}, []string{"token"})
+
+var ServerErrorRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "github_api_server_error_retries_total",
+	Help: "Total number of GitHub API requests retried after a 5xx response, by status code",
+}, []string{"status"})
+
+var NetworkErrorRetries = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "github_api_network_error_retries_total",
+	Help: "Total number of GitHub API requests retried after a transient network error",
+})
+
+var APIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "github_api_requests_total",
+	Help: "Total number of GitHub API requests sent, by endpoint and HTTP status or \"error\" for transport failures",
+}, []string{"endpoint", "status"})
+
+var APIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "github_api_request_duration_seconds",
+	Help:    "Latency of single GitHub API round trips by endpoint, excluding retries and waits",
+	Buckets: prometheus.DefBuckets,
+}, []string{"endpoint"})
+
+// CollectionDuration is observed once per cycle and tenant, with the cycle ID
+// as an exemplar.
+var CollectionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "copilot_premium_usage_exporter_collection_duration_seconds",
+	Help:    "Duration of collection cycles per enterprise, from the first request to publishing",
+	Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+}, []string{"enterprise"})
+
+var APIWaits = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "github_api_waits_total",
+	Help: "Total number of times the client paused before retrying, by reason (primary, secondary, preemptive, server_error, network_error, client_rate_limit)",
+}, []string{"reason"})
+
+var APIWaitSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "github_api_wait_seconds_total",
+	Help: "Total time in seconds the client spent paused before retrying, by reason",
+}, []string{"reason"})
+
+// Family describes a metric whose series are rebuilt from scratch every
+// collection cycle. Its samples are recorded into a MetricSet and only become
+// visible to scrapes once the whole set is published.
+type Family struct {
+	desc *prometheus.Desc
+	// tenantDescs replace desc when tenants are configured, one per tenant
+	// with the tenant as a constant label.
+	tenantDescs map[string]*prometheus.Desc
+	fqName      string
+	help        string
+	labels      []string
+	valueType   prometheus.ValueType
+	buckets     []float64
+}
+
+func newGauge(namespace, name, help string, labels []string) *Family {
+	fqName := prometheus.BuildFQName(namespace, "", name)
+	return &Family{
+		desc:      prometheus.NewDesc(fqName, help, labels, nil),
+		fqName:    fqName,
+		help:      help,
+		labels:    labels,
+		valueType: prometheus.GaugeValue,
+	}
+}
+
+func newHistogram(namespace, name, help string, labels []string, buckets []float64) *Family {
+	fqName := prometheus.BuildFQName(namespace, "", name)
+	return &Family{
+		desc:    prometheus.NewDesc(fqName, help, labels, nil),
+		fqName:  fqName,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+	}
+}
+
+func (f *Family) descFor(tenant string) *prometheus.Desc {
+	if f.tenantDescs == nil {
+		return f.desc
+	}
+	return f.tenantDescs[tenant]
+}
+
+var RequestAmount *Family
+var RequestCostGross *Family
+var RequestCostDiscount *Family
+var UserUsageStale *Family
+var SeatInfo *Family
+var SeatLicenseCost *Family
+var TotalSeats *Family
+var IncludedRequestsQuota *Family
+var IncludedRequestsUsed *Family
+var QuotaUtilization *Family
+var OverageRequests *Family
+var OverageCost *Family
+var UserCostForecast *Family
+var EnterpriseCostForecast *Family
+var UserCostDistribution *Family
+var UserCollectionFailed *Family
+var UserHasUsage *Family
+var UserUsageAnomalyScore *Family
+var UserUsageAnomalous *Family
+var CollectionComplete *Family
+
+// DataAge is computed at scrape time from when each tenant's latest set was
+// collected; it is never set in a MetricSet.
+var DataAge *Family
+var ActionsUsageQuantity *Family
+var ActionsUsageCostGross *Family
+var ActionsUsageCostNet *Family
+var PackagesUsageQuantity *Family
+var PackagesUsageCostGross *Family
+var PackagesUsageCostNet *Family
+var AdvancedSecurityCommitters *Family
+var AdvancedSecurityCommittersPurchased *Family
+
+// UserCollectionFailures and UsersGone count across cycles, so unlike the
+// families above they are regular collectors incremented as fetches happen.
+var UserCollectionFailures *prometheus.CounterVec
+var UsersGone *prometheus.CounterVec
+
+var DefaultCostBuckets = []float64{1, 5, 20, 100}
+
+type Options struct {
+	// Namespace prefixes every usage family, e.g. "github_copilot" yields
+	// github_copilot_user_usage_request_amount.
+	Namespace string
+	// UsageLabels are appended to the per-user usage label set, e.g.
+	// enrichment labels such as email.
+	UsageLabels []string
+	// Labels, when set, replace the whole per-user usage label set except
+	// enterprise, including UsageLabels.
+	Labels []string
+	// CostBuckets are the upper bounds in USD of the per-user cost histogram.
+	CostBuckets []float64
+	// Timestamps stamps every per-cycle sample with the time it was collected
+	// instead of leaving it to the scraper to assume the scrape time.
+	Timestamps bool
+	// Tenants, when set, adds a tenant label to every per-cycle family. Each
+	// MetricSet then belongs to one of them and is published alongside the
+	// others' latest sets.
+	Tenants []string
+	// StaleAfter, when set with DropStale, leaves a tenant's per-cycle series
+	// out of scrapes once its latest set is older than this.
+	StaleAfter time.Duration
+	DropStale  bool
+}
+
+var cycle *snapshotCollector
+
+// Register creates the usage metric families and registers them with reg.
+// Static labels shared by every series are applied by wrapping reg with
+// prometheus.WrapRegistererWith before calling Register.
+func Register(reg prometheus.Registerer, opts Options) error {
+	namespace := opts.Namespace
+	labels = append(append([]string{}, baseLabels...), opts.UsageLabels...)
+	if len(opts.Labels) > 0 {
+		labels = append(slices.Clone(opts.Labels), "enterprise")
+	}
+	buckets := opts.CostBuckets
+	if len(buckets) == 0 {
+		buckets = DefaultCostBuckets
+	}
+
+	RequestAmount = newGauge(namespace, "user_usage_request_amount",
+		"Number of Copilot premium requests per user, SKU, and model for the current month", labels)
+
+	RequestCostGross = newGauge(namespace, "user_usage_request_cost_gross",
+		"Gross cost in USD of Copilot premium requests per user, SKU, and model for the current month", labels)
+
+	RequestCostDiscount = newGauge(namespace, "user_usage_request_cost_discount",
+		"Discount amount in USD applied to Copilot premium requests per user, SKU, and model for the current month", labels)
+
+	UserUsageStale = newGauge(namespace, "user_usage_stale",
+		"1 if the user's usage series were carried over from an earlier cycle because the latest fetch failed, 0 if fresh",
+		[]string{"user", "enterprise"})
+
+	SeatInfo = newGauge(namespace, "seat_info",
+		"Always 1 for every Copilot seat holder, labelled with how the seat was assigned",
+		[]string{"user", "enterprise", "assigning_team", "plan_type"})
+
+	SeatLicenseCost = newGauge(namespace, "seat_license_cost",
+		"Monthly license price in USD of the user's Copilot seat, configured per plan",
+		[]string{"user", "enterprise", "plan_type"})
+
+	TotalSeats = newGauge(namespace, "total_seats",
+		"Copilot seats in the enterprise as reported by GitHub, to cross-check against the seat holders listed",
+		[]string{"enterprise"})
+
+	quotaLabels := []string{"user", "enterprise", "plan_type"}
+
+	IncludedRequestsQuota = newGauge(namespace, "user_included_requests_quota",
+		"Premium requests included per month in the user's Copilot plan", quotaLabels)
+
+	IncludedRequestsUsed = newGauge(namespace, "user_included_requests_used",
+		"Premium requests covered by the user's included quota for the current month", quotaLabels)
+
+	QuotaUtilization = newGauge(namespace, "user_quota_utilization_ratio",
+		"Premium requests used this month as a fraction of the included quota; above 1 means overage", quotaLabels)
+
+	OverageRequests = newGauge(namespace, "user_overage_requests",
+		"Billable premium requests beyond the included quota for the current month", quotaLabels)
+
+	OverageCost = newGauge(namespace, "user_overage_cost",
+		"Billable cost in USD of premium requests beyond the included quota for the current month", quotaLabels)
+
+	UserCostForecast = newGauge(namespace, "user_cost_forecast_month_end",
+		"Projected net cost in USD of the user's premium requests by the end of the billing month",
+		[]string{"user", "enterprise"})
+
+	EnterpriseCostForecast = newGauge(namespace, "enterprise_cost_forecast_month_end",
+		"Projected net cost in USD of all premium requests in the enterprise by the end of the billing month",
+		[]string{"enterprise"})
+
+	UserCostDistribution = newHistogram(namespace, "user_cost_distribution",
+		"Distribution of users' month-to-date net premium request cost in USD, rebuilt every collection cycle",
+		[]string{"enterprise"}, buckets)
+
+	UserCollectionFailed = newGauge(namespace, "user_collection_failed",
+		"1 if fetching the user's premium usage failed in the latest cycle, 0 if it succeeded",
+		[]string{"user", "enterprise"})
+
+	UserHasUsage = newGauge(namespace, "user_has_usage",
+		"1 if the seat holder made any premium requests this month, 0 if none, so idle seats have a series too",
+		[]string{"user", "enterprise"})
+
+	UserUsageAnomalyScore = newGauge(namespace, "user_usage_anomaly_score",
+		"Standard deviations by which the user's gross spend today lies above their recent daily spend",
+		[]string{"user", "enterprise"})
+
+	UserUsageAnomalous = newGauge(namespace, "user_usage_anomalous",
+		"1 if the user's anomaly score is at or above the configured threshold, 0 otherwise",
+		[]string{"user", "enterprise"})
+
+	CollectionComplete = newGauge(namespace, "collection_complete",
+		"1 if the latest cycle fetched every seat holder, 0 if it hit the cycle deadline and published partial results",
+		[]string{"enterprise"})
+
+	DataAge = newGauge(namespace, "data_age_seconds",
+		"Seconds since the latest published collection cycle was collected", nil)
+
+	billingLabels := []string{"enterprise", "organization", "sku", "unit_type"}
+
+	ActionsUsageQuantity = newGauge(namespace, "actions_usage_quantity",
+		"GitHub Actions usage in the SKU's unit (e.g. minutes) per organization for the current month", billingLabels)
+
+	ActionsUsageCostGross = newGauge(namespace, "actions_usage_cost_gross",
+		"Gross cost in USD of GitHub Actions usage per organization and SKU for the current month", billingLabels)
+
+	ActionsUsageCostNet = newGauge(namespace, "actions_usage_cost_net",
+		"Net billable cost in USD of GitHub Actions usage per organization and SKU for the current month", billingLabels)
+
+	PackagesUsageQuantity = newGauge(namespace, "packages_usage_quantity",
+		"GitHub Packages storage and data transfer in the SKU's unit per organization for the current month", billingLabels)
+
+	PackagesUsageCostGross = newGauge(namespace, "packages_usage_cost_gross",
+		"Gross cost in USD of GitHub Packages usage per organization and SKU for the current month", billingLabels)
+
+	PackagesUsageCostNet = newGauge(namespace, "packages_usage_cost_net",
+		"Net billable cost in USD of GitHub Packages usage per organization and SKU for the current month", billingLabels)
+
+	AdvancedSecurityCommitters = newGauge(namespace, "advanced_security_committers",
+		"Active GitHub Advanced Security committers across the enterprise", []string{"enterprise"})
+
+	AdvancedSecurityCommittersPurchased = newGauge(namespace, "advanced_security_committers_purchased",
+		"GitHub Advanced Security committer licences purchased by the enterprise", []string{"enterprise"})
+
+	UserCollectionFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "user_collection_failures_total",
+		Help:      "Total number of failed per-user premium usage fetches by error class",
+	}, []string{"enterprise", "class"})
+
+	UsersGone = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "users_gone_total",
+		Help:      "Total number of seat holders found removed when their premium usage was fetched, whose series were dropped",
+	}, []string{"enterprise"})
+
+	cycle = &snapshotCollector{timestamps: opts.Timestamps, staleAfter: opts.StaleAfter, dropStale: opts.DropStale, families: []*Family{
+		RequestAmount,
+		RequestCostGross,
+		RequestCostDiscount,
+		UserUsageStale,
+		SeatInfo,
+		SeatLicenseCost,
+		TotalSeats,
+		IncludedRequestsQuota,
+		IncludedRequestsUsed,
+		QuotaUtilization,
+		OverageRequests,
+		OverageCost,
+		UserCostForecast,
+		EnterpriseCostForecast,
+		UserCostDistribution,
+		UserCollectionFailed,
+		UserHasUsage,
+		UserUsageAnomalyScore,
+		UserUsageAnomalous,
+		CollectionComplete,
+		DataAge,
+		ActionsUsageQuantity,
+		ActionsUsageCostGross,
+		ActionsUsageCostNet,
+		PackagesUsageQuantity,
+		PackagesUsageCostGross,
+		PackagesUsageCostNet,
+		AdvancedSecurityCommitters,
+		AdvancedSecurityCommittersPurchased,
+	}}
+	if len(opts.Tenants) > 0 {
+		for _, f := range cycle.families {
+			f.tenantDescs = make(map[string]*prometheus.Desc, len(opts.Tenants))
+			for _, t := range opts.Tenants {
+				f.tenantDescs[t] = prometheus.NewDesc(f.fqName, f.help, f.labels, prometheus.Labels{"tenant": t})
+			}
+		}
+	}
+
+	collectors := []prometheus.Collector{
+		cycle,
+		BuildInfo,
+		UserCollectionFailures,
+		UsersGone,
+		RateLimitRemaining,
+		RateLimitReset,
+		TokenExpiration,
+		ServerErrorRetries,
+		NetworkErrorRetries,
+		APIRequests,
+		APIRequestDuration,
+		CollectionDuration,
+		APIWaits,
+		APIWaitSeconds,
+	}
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exemplar returns labels plus the ID of the sampled trace in ctx, if any.
+// Empty values are left out.
+func Exemplar(ctx context.Context, labels prometheus.Labels) prometheus.Labels {
+	out := prometheus.Labels{}
+	for k, v := range labels {
+		if v != "" {
+			out[k] = v
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsSampled() {
+		out["trace_id"] = sc.TraceID().String()
+	}
+	return out
+}
+
+// ObserveWithExemplar records value in o with exemplar attached when there is
+// one. Exemplars are only exposed to OpenMetrics scrapes.
+func ObserveWithExemplar(o prometheus.Observer, value float64, exemplar prometheus.Labels) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && len(exemplar) > 0 {
+		eo.ObserveWithExemplar(value, exemplar)
+		return
+	}
+	o.Observe(value)
+}
+
+// UsageLabels returns the label names of the per-user usage families, in the
+// order they were registered.
+func UsageLabels() []string {
+	return labels
+}
+
+type gaugeSample struct {
+	labelValues []string
+	value       float64
+}
+
+type histogramSample struct {
+	labelValues []string
+	count       uint64
+	sum         float64
+	buckets     map[float64]uint64
+}
+
+// MetricSet accumulates one cycle's samples. Setting the same series twice
+// keeps the last value. A MetricSet is not safe for
+// concurrent use.
+type MetricSet struct {
+	tenant      string
+	collectedAt time.Time
+	gauges      map[*Family]map[string]gaugeSample
+	histograms  map[*Family]map[string]*histogramSample
+}
+
+// NewMetricSet starts a set for tenant, which must be one of Options.Tenants,
+// or "" when none are configured.
+func NewMetricSet(tenant string, collectedAt time.Time) *MetricSet {
+	return &MetricSet{
+		tenant:      tenant,
+		collectedAt: collectedAt,
+		gauges:      make(map[*Family]map[string]gaugeSample),
+		histograms:  make(map[*Family]map[string]*histogramSample),
+	}
+}
+
+// Set records a gauge sample with label values in the family's label order.
+func (s *MetricSet) Set(f *Family, value float64, labelValues ...string) {
+	series, ok := s.gauges[f]
+	if !ok {
+		series = make(map[string]gaugeSample)
+		s.gauges[f] = series
+	}
+	series[seriesKey(labelValues)] = gaugeSample{labelValues: labelValues, value: value}
+}
+
+// Add adds value to a gauge sample, for series that several items fold
+// into.
+func (s *MetricSet) Add(f *Family, value float64, labelValues ...string) {
+	series, ok := s.gauges[f]
+	if !ok {
+		series = make(map[string]gaugeSample)
+		s.gauges[f] = series
+	}
+	key := seriesKey(labelValues)
+	series[key] = gaugeSample{labelValues: labelValues, value: series[key].value + value}
+}
+
+// SetWith records a gauge sample with labels given by name. Labels missing
+// from the map are left empty.
+func (s *MetricSet) SetWith(f *Family, labels prometheus.Labels, value float64) {
+	values := make([]string, len(f.labels))
+	for i, name := range f.labels {
+		values[i] = labels[name]
+	}
+	s.Set(f, value, values...)
+}
+
+// Observe adds value to a histogram family's series.
+func (s *MetricSet) Observe(f *Family, value float64, labelValues ...string) {
+	series, ok := s.histograms[f]
+	if !ok {
+		series = make(map[string]*histogramSample)
+		s.histograms[f] = series
+	}
+	key := seriesKey(labelValues)
+	h, ok := series[key]
+	if !ok {
+		h = &histogramSample{labelValues: labelValues, buckets: make(map[float64]uint64, len(f.buckets))}
+		series[key] = h
+	}
+	h.count++
+	h.sum += value
+	for _, upper := range f.buckets {
+		if value <= upper {
+			h.buckets[upper]++
+		}
+	}
+}
+
+// Publish atomically replaces every per-cycle series of s's tenant with those
+// in s, so a scrape sees either the previous cycle or this one and never a
+// mix. It consumes s: each family's samples are released once converted, so
+// samples and metrics for the whole enterprise are never held twice over.
+func Publish(s *MetricSet) error {
+	n := 0
+	for _, series := range s.gauges {
+		n += len(series)
+	}
+	for _, series := range s.histograms {
+		n += len(series)
+	}
+	metrics := make([]prometheus.Metric, 0, n)
+	for f, series := range s.gauges {
+		delete(s.gauges, f)
+		for _, g := range series {
+			m, err := prometheus.NewConstMetric(f.descFor(s.tenant), f.valueType, g.value, g.labelValues...)
+			if err != nil {
+				return err
+			}
+			metrics = append(metrics, m)
+		}
+	}
+	for f, series := range s.histograms {
+		delete(s.histograms, f)
+		for _, h := range series {
+			// The histogram is rebuilt from this cycle's users alone, so its
+			// count and sum start over at collection time.
+			m, err := prometheus.NewConstHistogramWithCreatedTimestamp(f.descFor(s.tenant), h.count, h.sum, h.buckets, s.collectedAt, h.labelValues...)
+			if err != nil {
+				return err
+			}
+			metrics = append(metrics, m)
+		}
+	}
+	if cycle.timestamps {
+		for i, m := range metrics {
+			metrics[i] = prometheus.NewMetricWithTimestamp(s.collectedAt, m)
+		}
+	}
+	cycle.mu.Lock()
+	defer cycle.mu.Unlock()
+	current := make(map[string]publishedSet)
+	if prev := cycle.current.Load(); prev != nil {
+		maps.Copy(current, *prev)
+	}
+	current[s.tenant] = publishedSet{collectedAt: s.collectedAt, metrics: metrics}
+	cycle.current.Store(&current)
+	return nil
+}
+
+// OldestDataAge returns how long ago the oldest of the tenants' latest sets was
+// collected, and false before anything has been published.
+func OldestDataAge() (time.Duration, bool) {
+	current := cycle.current.Load()
+	if current == nil {
+		return 0, false
+	}
+	var age time.Duration
+	for _, p := range *current {
+		age = max(age, time.Since(p.collectedAt))
+	}
+	return age, true
+}
+
+type publishedSet struct {
+	collectedAt time.Time
+	metrics     []prometheus.Metric
+}
+
+// seriesKey joins label values with a byte that cannot appear in valid UTF-8
+// so distinct label sets never collide.
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
 
-var RequestAmount *prometheus.GaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
-	Name: "github_copilot_user_usage_request_amount",
-	Help: "Number of Copilot premium requests per user, SKU, and model for the current month",
-}, labels)
+// snapshotCollector serves the metrics of the last published MetricSet of
+// each tenant.
+type snapshotCollector struct {
+	families   []*Family
+	timestamps bool
+	mu         sync.Mutex // serializes Publish
+	staleAfter time.Duration
+	dropStale  bool
+	current    atomic.Pointer[map[string]publishedSet]
+}
 
-var RequestCostGross *prometheus.GaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
-	Name: "github_copilot_user_usage_request_cost_gross",
-	Help: "Gross cost in USD of Copilot premium requests per user, SKU, and model for the current month",
-}, labels)
+func (c *snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, f := range c.families {
+		if f.tenantDescs == nil {
+			ch <- f.desc
+			continue
+		}
+		for _, d := range f.tenantDescs {
+			ch <- d
+		}
+	}
+}
 
-var RequestCostDiscount *prometheus.GaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
-	Name: "github_copilot_user_usage_request_cost_discount",
-	Help: "Discount amount in USD applied to Copilot premium requests per user, SKU, and model for the current month",
-}, labels)
+func (c *snapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	current := c.current.Load()
+	if current == nil {
+		return
+	}
+	for tenant, p := range *current {
+		age := time.Since(p.collectedAt)
+		ch <- prometheus.MustNewConstMetric(DataAge.descFor(tenant), prometheus.GaugeValue, age.Seconds())
+		if c.dropStale && c.staleAfter > 0 && age > c.staleAfter {
+			continue
+		}
+		for _, m := range p.metrics {
+			ch <- m
+		}
+	}
+}
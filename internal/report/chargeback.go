@@ -0,0 +1,148 @@
+// Package report builds the chargeback statements handed to finance at the
+// end of each billing period.
+package report
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/billing"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+)
+
+// TeamCharge is what one assigning team is charged for a billing period:
+// the license price of its seats plus its premium request spend.
+type TeamCharge struct {
+	Team            string  `json:"team"`
+	CostCenter      string  `json:"costCenter"`
+	Seats           int     `json:"seats"`
+	LicenseCost     float64 `json:"licenseCost"`
+	PremiumRequests float64 `json:"premiumRequests"`
+	GrossAmount     float64 `json:"grossAmount"`
+	DiscountAmount  float64 `json:"discountAmount"`
+	NetAmount       float64 `json:"netAmount"`
+	TotalCost       float64 `json:"totalCost"`
+}
+
+type Chargeback struct {
+	Enterprise  string       `json:"enterprise"`
+	PeriodStart time.Time    `json:"periodStart"`
+	PeriodEnd   time.Time    `json:"periodEnd"`
+	CollectedAt time.Time    `json:"collectedAt"`
+	Teams       []TeamCharge `json:"teams"`
+	TotalCost   float64      `json:"totalCost"`
+}
+
+// CostCenters maps assigning team slugs to cost centers. Teams that are not
+// listed, including seats assigned directly, are charged to Default.
+type CostCenters struct {
+	Teams   map[string]string
+	Default string
+}
+
+func (c CostCenters) For(team string) string {
+	if cc, ok := c.Teams[team]; ok {
+		return cc
+	}
+	return c.Default
+}
+
+// BuildChargeback totals snap by team. Every seat is charged the full monthly
+// license price of its plan, so the snapshot should be the last one collected
+// in period. Teams are ordered by cost center, then team.
+func BuildChargeback(snap *snapshot.Snapshot, period billing.Period, prices billing.LicensePrices, costCenters CostCenters) *Chargeback {
+	index := make(map[string]int)
+	var teams []TeamCharge
+	team := func(name string) *TeamCharge {
+		i, ok := index[name]
+		if !ok {
+			i = len(teams)
+			index[name] = i
+			teams = append(teams, TeamCharge{Team: name, CostCenter: costCenters.For(name)})
+		}
+		return &teams[i]
+	}
+
+	for _, seat := range snap.Seats {
+		t := team(seat.Team)
+		t.Seats++
+		t.LicenseCost += prices.ForPlan(seat.PlanType)
+	}
+	for _, r := range snap.Records {
+		t := team(r.Team)
+		t.PremiumRequests += r.GrossQuantity
+		t.GrossAmount += r.GrossAmount
+		t.DiscountAmount += r.DiscountAmount
+		t.NetAmount += r.NetAmount
+	}
+
+	c := &Chargeback{
+		Enterprise:  snap.Enterprise,
+		PeriodStart: period.Start,
+		PeriodEnd:   period.End,
+		CollectedAt: snap.CollectedAt,
+	}
+	for i := range teams {
+		teams[i].TotalCost = teams[i].LicenseCost + teams[i].NetAmount
+		c.TotalCost += teams[i].TotalCost
+	}
+	slices.SortFunc(teams, func(a, b TeamCharge) int {
+		return cmp.Or(cmp.Compare(a.CostCenter, b.CostCenter), cmp.Compare(a.Team, b.Team))
+	})
+	c.Teams = teams
+	return c
+}
+
+func (c *Chargeback) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding chargeback: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+var csvHeader = []string{
+	"period", "enterprise", "cost_center", "team", "seats", "license_cost",
+	"premium_requests", "gross_amount", "discount_amount", "net_amount", "total_cost",
+}
+
+// CSV renders one row per team, amounts rounded to cents.
+func (c *Chargeback) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(csvHeader); err != nil {
+		return nil, fmt.Errorf("encoding chargeback: %w", err)
+	}
+	period := c.PeriodStart.Format("2006-01")
+	for _, t := range c.Teams {
+		row := []string{
+			period,
+			c.Enterprise,
+			t.CostCenter,
+			t.Team,
+			strconv.Itoa(t.Seats),
+			money(t.LicenseCost),
+			strconv.FormatFloat(t.PremiumRequests, 'f', -1, 64),
+			money(t.GrossAmount),
+			money(t.DiscountAmount),
+			money(t.NetAmount),
+			money(t.TotalCost),
+		}
+		if err := w.Write(row); err != nil {
+			return nil, fmt.Errorf("encoding chargeback: %w", err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("encoding chargeback: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func money(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
@@ -0,0 +1,157 @@
+// Package rules generates Prometheus recording and alerting rules for the
+// exporter's metrics as deployed, so rule files use the configured namespace
+// and labels instead of drifting from them.
+package rules
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Options describe the deployment the rules are generated for.
+type Options struct {
+	Namespace string
+	// Labels are kept by every rollup in addition to enterprise, e.g. tenant
+	// and any static extra labels.
+	Labels []string
+	// UsageLabels are the labels the per-user usage series carry.
+	UsageLabels []string
+	// StaleAfter is the data age at which the stale data alert fires.
+	StaleAfter time.Duration
+	// MonthlyBudget is the net spend in USD per enterprise above which the
+	// over budget alerts fire. They are left out when it is 0.
+	MonthlyBudget float64
+}
+
+type ruleFile struct {
+	Groups []group `yaml:"groups"`
+}
+
+type group struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// Generate returns a Prometheus rule file for opts.
+func Generate(opts Options) ([]byte, error) {
+	ns := opts.Namespace
+	metric := func(name string) string {
+		if ns == "" {
+			return name
+		}
+		return ns + "_" + name
+	}
+	by := func(extra ...string) string {
+		return strings.Join(append(append([]string{"enterprise"}, opts.Labels...), extra...), ", ")
+	}
+	net := fmt.Sprintf("(%s - %s)", metric("user_usage_request_cost_gross"), metric("user_usage_request_cost_discount"))
+	netRecord := "enterprise:" + metric("cost_net") + ":sum"
+
+	recording := []rule{
+		{
+			Record: netRecord,
+			Expr:   fmt.Sprintf("sum by (%s) %s", by(), net),
+		},
+		{
+			Record: "enterprise:" + metric("requests") + ":sum",
+			Expr:   fmt.Sprintf("sum by (%s) (%s)", by(), metric("user_usage_request_amount")),
+		},
+	}
+	if slices.Contains(opts.UsageLabels, "model") {
+		recording = append(recording, rule{
+			Record: "model:" + metric("cost_net") + ":sum",
+			Expr:   fmt.Sprintf("sum by (%s) %s", by("model"), net),
+		})
+	}
+	// Without the assigning_team usage label the team comes from seat_info,
+	// joined on user.
+	if slices.Contains(opts.UsageLabels, "assigning_team") {
+		recording = append(recording, rule{
+			Record: "team:" + metric("cost_net") + ":sum",
+			Expr:   fmt.Sprintf("sum by (%s) %s", by("assigning_team"), net),
+		})
+	} else if slices.Contains(opts.UsageLabels, "user") {
+		recording = append(recording, rule{
+			Record: "team:" + metric("cost_net") + ":sum",
+			Expr: fmt.Sprintf("sum by (%s) (sum by (%s) %s * on (%s) group_left (assigning_team) %s)",
+				by("assigning_team"), by("user"), net, by("user"), metric("seat_info")),
+		})
+	}
+	if slices.Contains(opts.UsageLabels, "department") {
+		recording = append(recording, rule{
+			Record: "department:" + metric("cost_net") + ":sum",
+			Expr:   fmt.Sprintf("sum by (%s) %s", by("department"), net),
+		})
+	}
+
+	alerting := []rule{
+		{
+			Alert: "CopilotUsageDataStale",
+			Expr:  fmt.Sprintf("%s > %d", metric("data_age_seconds"), int(opts.StaleAfter.Seconds())),
+			For:   "10m",
+			Labels: map[string]string{
+				"severity": "warning",
+			},
+			Annotations: map[string]string{
+				"summary":     "Copilot premium usage data is stale",
+				"description": "The latest published collection cycle is {{ $value | humanizeDuration }} old; collection has stopped succeeding.",
+			},
+		},
+		{
+			Alert: "CopilotGitHubRateLimited",
+			Expr:  `sum by (reason) (increase(github_api_waits_total{reason=~"primary|secondary|preemptive"}[1h])) > 0`,
+			Labels: map[string]string{
+				"severity": "warning",
+			},
+			Annotations: map[string]string{
+				"summary":     "The exporter is waiting on GitHub API rate limits",
+				"description": "Collection paused {{ $value }} times in the last hour for the {{ $labels.reason }} rate limit; add tokens or lower the collection frequency.",
+			},
+		},
+	}
+	if opts.MonthlyBudget > 0 {
+		alerting = append(alerting,
+			rule{
+				Alert: "CopilotSpendForecastOverBudget",
+				Expr:  fmt.Sprintf("%s > %g", metric("enterprise_cost_forecast_month_end"), opts.MonthlyBudget),
+				For:   "1h",
+				Labels: map[string]string{
+					"severity": "warning",
+				},
+				Annotations: map[string]string{
+					"summary":     "Copilot premium request spend is forecast to exceed the monthly budget",
+					"description": fmt.Sprintf("{{ $labels.enterprise }} is forecast to spend ${{ $value | printf \"%%.2f\" }} this month against a budget of $%g.", opts.MonthlyBudget),
+				},
+			},
+			rule{
+				Alert: "CopilotSpendOverBudget",
+				Expr:  fmt.Sprintf("%s > %g", netRecord, opts.MonthlyBudget),
+				Labels: map[string]string{
+					"severity": "critical",
+				},
+				Annotations: map[string]string{
+					"summary":     "Copilot premium request spend exceeds the monthly budget",
+					"description": fmt.Sprintf("{{ $labels.enterprise }} has spent ${{ $value | printf \"%%.2f\" }} this month against a budget of $%g.", opts.MonthlyBudget),
+				},
+			},
+		)
+	}
+
+	return yaml.Marshal(ruleFile{Groups: []group{
+		{Name: "copilot-premium-usage.rules", Rules: recording},
+		{Name: "copilot-premium-usage.alerts", Rules: alerting},
+	}})
+}
@@ -0,0 +1,58 @@
+package schedule
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Scheduler decides when the next collection cycle starts. Cycles are anchored
+// to their slot rather than their end, so a long collection does not push
+// every following cycle later, and an optional random jitter, added on top of
+// each slot, spreads exporters that were deployed at the same moment.
+type Scheduler struct {
+	interval time.Duration
+	cron     cron.Schedule
+	jitter   time.Duration
+}
+
+// New returns a Scheduler that fires every interval, or on the standard
+// five-field cron expression expr when it is non-empty (descriptors such as
+// "@hourly" are accepted too).
+func New(interval time.Duration, expr string, jitter time.Duration) (*Scheduler, error) {
+	s := &Scheduler{interval: interval, jitter: jitter}
+	if expr != "" {
+		sched, err := cron.ParseStandard(expr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing schedule %q: %w", expr, err)
+		}
+		s.cron = sched
+	} else if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive, got %s", interval)
+	}
+	return s, nil
+}
+
+// Next returns the slot of the cycle following the one in slot prev, given
+// that it is now now, and the time to start it at: the slot plus a random
+// jitter. Passing the returned slot rather than the actual start back as prev
+// keeps jitter from accumulating into drift. A cycle that overran its
+// interval is followed immediately; with a cron expression missed slots are
+// skipped.
+func (s *Scheduler) Next(prev, now time.Time) (slot, at time.Time) {
+	if s.cron != nil {
+		slot = s.cron.Next(now)
+	} else {
+		slot = prev.Add(s.interval)
+		if slot.Before(now) {
+			slot = now
+		}
+	}
+	at = slot
+	if s.jitter > 0 {
+		at = at.Add(rand.N(s.jitter))
+	}
+	return slot, at
+}
@@ -0,0 +1,109 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	base := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		interval time.Duration
+		expr     string
+		prev     time.Time
+		now      time.Time
+		want     time.Time
+	}{
+		{
+			name:     "interval after slot",
+			interval: 5 * time.Minute,
+			prev:     base,
+			now:      base.Add(time.Minute),
+			want:     base.Add(5 * time.Minute),
+		},
+		{
+			name:     "interval ignores when the cycle ended",
+			interval: 5 * time.Minute,
+			prev:     base,
+			now:      base.Add(4*time.Minute + 59*time.Second),
+			want:     base.Add(5 * time.Minute),
+		},
+		{
+			name:     "overran interval runs immediately",
+			interval: 5 * time.Minute,
+			prev:     base,
+			now:      base.Add(7 * time.Minute),
+			want:     base.Add(7 * time.Minute),
+		},
+		{
+			name: "cron skips missed slots",
+			expr: "0 * * * *",
+			prev: base,
+			now:  base.Add(2*time.Hour + 30*time.Minute),
+			want: base.Add(3 * time.Hour),
+		},
+		{
+			name: "cron descriptor",
+			expr: "@daily",
+			prev: base,
+			now:  base,
+			want: time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(tt.interval, tt.expr, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slot, at := s.Next(tt.prev, tt.now)
+			if !slot.Equal(tt.want) {
+				t.Errorf("slot = %s, want %s", slot, tt.want)
+			}
+			if !at.Equal(slot) {
+				t.Errorf("at = %s, want the slot %s without jitter", at, slot)
+			}
+		})
+	}
+}
+
+func TestNextJitterDoesNotDrift(t *testing.T) {
+	const interval, jitter = 5 * time.Minute, time.Minute
+	s, err := New(interval, "", jitter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	for i := 1; i <= 100; i++ {
+		var at time.Time
+		// Each cycle starts at its jittered time and is anchored on its slot.
+		slot, at = s.Next(slot, slot)
+		want := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC).Add(time.Duration(i) * interval)
+		if !slot.Equal(want) {
+			t.Fatalf("cycle %d: slot = %s, want %s", i, slot, want)
+		}
+		if at.Before(slot) || !at.Before(slot.Add(jitter)) {
+			t.Fatalf("cycle %d: at = %s, want within %s after %s", i, at, jitter, slot)
+		}
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		expr     string
+	}{
+		{"zero interval", 0, ""},
+		{"negative interval", -time.Minute, ""},
+		{"invalid cron", time.Minute, "every hour"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.interval, tt.expr, 0); err == nil {
+				t.Error("New() succeeded, want an error")
+			}
+		})
+	}
+}
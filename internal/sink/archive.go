@@ -0,0 +1,96 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/storage"
+)
+
+// Archive writes every snapshot as one Parquet or CSV file of UsageRows,
+// under Hive-style date partitions so Athena and Spark can prune by day:
+//
+//	usage/enterprise=<slug>/date=2006-01-02/20060102T150405Z.parquet
+//
+// A named tenant gets a tenant=<name>/ partition in front of enterprise=, so
+// tenants sharing a slug on different hosts never mix.
+type Archive struct {
+	bucket storage.Bucket
+	format string
+}
+
+func NewArchive(ctx context.Context, location, format string) (*Archive, error) {
+	if format != "parquet" && format != "csv" {
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+	bucket, err := storage.Open(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{bucket: bucket, format: format}, nil
+}
+
+func (a *Archive) Name() string { return "archive" }
+
+func (a *Archive) Write(ctx context.Context, snap *snapshot.Snapshot) error {
+	rows := usageRows(snap)
+	var data []byte
+	var contentType string
+	var err error
+	if a.format == "parquet" {
+		data, err = encodeParquet(rows)
+		contentType = "application/vnd.apache.parquet"
+	} else {
+		data, err = encodeCSV(rows)
+		contentType = "text/csv"
+	}
+	if err != nil {
+		return err
+	}
+
+	at := snap.CollectedAt.UTC()
+	prefix := "usage/"
+	if snap.Tenant != "" {
+		prefix += "tenant=" + snap.Tenant + "/"
+	}
+	key := fmt.Sprintf("%senterprise=%s/date=%s/%s.%s",
+		prefix, snap.Enterprise, at.Format(time.DateOnly), at.Format("20060102T150405Z"), a.format)
+	return a.bucket.Put(ctx, key, data, contentType)
+}
+
+func (a *Archive) Close() error { return a.bucket.Close() }
+
+func encodeParquet(rows []UsageRow) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, rows, parquet.Compression(&parquet.Zstd)); err != nil {
+		return nil, fmt.Errorf("encoding parquet: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeCSV(rows []UsageRow) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{
+		"collected_at", "tenant", "enterprise", "user", "sku", "model",
+		"gross_quantity", "net_quantity", "gross_amount", "discount_amount", "net_amount",
+	})
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for _, r := range rows {
+		w.Write([]string{
+			r.CollectedAt.UTC().Format(time.RFC3339), r.Tenant, r.Enterprise, r.User, r.SKU, r.Model,
+			f(r.GrossQuantity), f(r.NetQuantity), f(r.GrossAmount), f(r.DiscountAmount), f(r.NetAmount),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("encoding csv: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,49 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"cloud.google.com/go/bigquery"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+)
+
+// bigQueryBatch is how many rows each streaming insert carries, the size
+// BigQuery recommends to stay under its per-request limits.
+const bigQueryBatch = 500
+
+// BigQuery streams every snapshot into an existing table whose columns match
+// UsageRow, with collected_at a TIMESTAMP. Credentials come from Application
+// Default Credentials, including GKE workload identity.
+type BigQuery struct {
+	client   *bigquery.Client
+	inserter *bigquery.Inserter
+}
+
+func NewBigQuery(ctx context.Context, project, dataset, table string) (*BigQuery, error) {
+	client, err := bigquery.NewClient(ctx, project)
+	if err != nil {
+		return nil, fmt.Errorf("creating bigquery client: %w", err)
+	}
+	return &BigQuery{client: client, inserter: client.Dataset(dataset).Table(table).Inserter()}, nil
+}
+
+func (b *BigQuery) Name() string { return "bigquery" }
+
+func (b *BigQuery) Write(ctx context.Context, snap *snapshot.Snapshot) error {
+	rows := usageRows(snap)
+	if len(rows) == 0 {
+		return nil
+	}
+	first := 0
+	for chunk := range slices.Chunk(rows, bigQueryBatch) {
+		if err := b.inserter.Put(ctx, chunk); err != nil {
+			return fmt.Errorf("inserting rows %d-%d of %d into bigquery: %w", first+1, first+len(chunk), len(rows), err)
+		}
+		first += len(chunk)
+	}
+	return nil
+}
+
+func (b *BigQuery) Close() error { return b.client.Close() }
@@ -0,0 +1,117 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+)
+
+// datadogBatchSize keeps each submission well under the API's 5 MB
+// uncompressed payload limit.
+const datadogBatchSize = 1000
+
+// datadogGauge is the metric intake type for gauges in API v2.
+const datadogGauge = 3
+
+type DatadogConfig struct {
+	APIKey string
+	// Site is the Datadog site, e.g. datadoghq.com or datadoghq.eu.
+	Site string
+	// Tags are added to every series.
+	Tags []string
+	// TagMapping renames Prometheus labels to Datadog tag keys; unlisted
+	// labels keep their name.
+	TagMapping map[string]string
+	// ProcessWide sends the gauges without a tenant label, which in
+	// multi-tenant mode only one tenant's sink should do.
+	ProcessWide bool
+}
+
+// Datadog submits the registry's gauges straight to the Datadog metrics API,
+// for environments without a local agent.
+type Datadog struct {
+	conf       DatadogConfig
+	url        string
+	gatherer   prometheus.Gatherer
+	httpClient *http.Client
+}
+
+func NewDatadog(conf DatadogConfig, gatherer prometheus.Gatherer) *Datadog {
+	return &Datadog{
+		conf:       conf,
+		url:        fmt.Sprintf("https://api.%s/api/v2/series", conf.Site),
+		gatherer:   gatherer,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (d *Datadog) Name() string { return "datadog" }
+
+type datadogPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+type datadogSeries struct {
+	Metric string         `json:"metric"`
+	Type   int            `json:"type"`
+	Points []datadogPoint `json:"points"`
+	Tags   []string       `json:"tags"`
+}
+
+func (d *Datadog) Write(ctx context.Context, snap *snapshot.Snapshot) error {
+	gs, err := gauges(d.gatherer, snap.Tenant, d.conf.ProcessWide)
+	if err != nil {
+		return err
+	}
+	series := make([]datadogSeries, len(gs))
+	for i, g := range gs {
+		series[i] = datadogSeries{
+			Metric: g.name,
+			Type:   datadogGauge,
+			Points: []datadogPoint{{Timestamp: snap.CollectedAt.Unix(), Value: g.value}},
+			Tags:   append(g.tags(d.conf.TagMapping), d.conf.Tags...),
+		}
+	}
+
+	for start := 0; start < len(series); start += datadogBatchSize {
+		end := min(start+datadogBatchSize, len(series))
+		if err := d.submit(ctx, series[start:end]); err != nil {
+			return fmt.Errorf("submitting series %d-%d of %d to datadog: %w", start, end, len(series), err)
+		}
+	}
+	return nil
+}
+
+func (d *Datadog) submit(ctx context.Context, series []datadogSeries) error {
+	body, err := json.Marshal(map[string]any{"series": series})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", d.conf.APIKey)
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (d *Datadog) Close() error { return nil }
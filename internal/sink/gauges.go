@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gauge is one gauge series from the Prometheus registry.
+type gauge struct {
+	name   string
+	labels []*dto.LabelPair
+	value  float64
+}
+
+// tags renders the labels as name:value tags, renaming the labels listed in
+// rename.
+func (g gauge) tags(rename map[string]string) []string {
+	tags := make([]string, 0, len(g.labels))
+	for _, l := range g.labels {
+		name := l.GetName()
+		if to, ok := rename[name]; ok {
+			name = to
+		}
+		tags = append(tags, name+":"+l.GetValue())
+	}
+	return tags
+}
+
+// gauges gathers every gauge series, so the push sinks emit exactly what
+// /metrics serves. Counters and histograms are left out: they are cumulative
+// and would need delta tracking to mean the same thing elsewhere. A non-empty
+// tenant also leaves out the series labelled with any other tenant, and the
+// series without a tenant label unless processWide is set, so only one
+// tenant's sink pushes the process-wide gauges.
+func gauges(gatherer prometheus.Gatherer, tenant string, processWide bool) ([]gauge, error) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return nil, fmt.Errorf("gathering metrics: %w", err)
+	}
+	var out []gauge
+	for _, mf := range families {
+		if mf.GetType() != dto.MetricType_GAUGE {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if tenant != "" && !tenantOf(m, tenant, processWide) {
+				continue
+			}
+			out = append(out, gauge{name: mf.GetName(), labels: m.GetLabel(), value: m.GetGauge().GetValue()})
+		}
+	}
+	return out, nil
+}
+
+// tenantOf reports whether m is labelled with tenant, or has no tenant label
+// and untenanted is set.
+func tenantOf(m *dto.Metric, tenant string, untenanted bool) bool {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == "tenant" {
+			return l.GetValue() == tenant
+		}
+	}
+	return untenanted
+}
@@ -0,0 +1,42 @@
+package sink
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestGaugesPerTenant(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	seats := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "seats"}, []string{"tenant"})
+	seats.WithLabelValues("eu").Set(1)
+	seats.WithLabelValues("us").Set(2)
+	registry.MustRegister(seats, prometheus.NewGauge(prometheus.GaugeOpts{Name: "build_info"}))
+
+	for _, tt := range []struct {
+		name        string
+		tenant      string
+		processWide bool
+		want        []string
+	}{
+		{"single tenant", "", true, []string{"build_info", "seats:tenant:eu", "seats:tenant:us"}},
+		{"first tenant", "eu", true, []string{"build_info", "seats:tenant:eu"}},
+		{"other tenant", "us", false, []string{"seats:tenant:us"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			series, err := gauges(registry, tt.tenant, tt.processWide)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, g := range series {
+				got = append(got, strings.Join(append([]string{g.name}, g.tags(nil)...), ":"))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("gauges = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
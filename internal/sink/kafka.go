@@ -0,0 +1,286 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/billing"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+)
+
+// usageEventSchemaVersion is bumped on any incompatible change to UsageEvent.
+const usageEventSchemaVersion = 1
+
+type UsageTotals struct {
+	GrossQuantity  float64 `json:"grossQuantity"`
+	NetQuantity    float64 `json:"netQuantity"`
+	GrossAmount    float64 `json:"grossAmount"`
+	DiscountAmount float64 `json:"discountAmount"`
+	NetAmount      float64 `json:"netAmount"`
+}
+
+func (t *UsageTotals) add(r snapshot.Record) {
+	t.GrossQuantity += r.GrossQuantity
+	t.NetQuantity += r.NetQuantity
+	t.GrossAmount += r.GrossAmount
+	t.DiscountAmount += r.DiscountAmount
+	t.NetAmount += r.NetAmount
+}
+
+func (t UsageTotals) sub(o UsageTotals) UsageTotals {
+	return UsageTotals{
+		GrossQuantity:  t.GrossQuantity - o.GrossQuantity,
+		NetQuantity:    t.NetQuantity - o.NetQuantity,
+		GrossAmount:    t.GrossAmount - o.GrossAmount,
+		DiscountAmount: t.DiscountAmount - o.DiscountAmount,
+		NetAmount:      t.NetAmount - o.NetAmount,
+	}
+}
+
+type UsageEventItem struct {
+	SKU   string `json:"sku"`
+	Model string `json:"model"`
+	UsageTotals
+}
+
+// UsageEvent is the value of each Kafka message, keyed by user. Total is
+// month-to-date; Delta is the change since the previous event for the user
+// in the same billing period. Baseline marks an event without one, whose
+// Delta is its Total: the user's first in the period, or the first after the
+// exporter lost track of what it sent. Consumers summing deltas should reset
+// the user's period total to Total on a baseline event instead of adding it.
+type UsageEvent struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Tenant        string           `json:"tenant,omitempty"`
+	Enterprise    string           `json:"enterprise"`
+	User          string           `json:"user"`
+	Team          string           `json:"team"`
+	PlanType      string           `json:"planType"`
+	CollectedAt   time.Time        `json:"collectedAt"`
+	PeriodStart   time.Time        `json:"periodStart"`
+	Stale         bool             `json:"stale"`
+	Baseline      bool             `json:"baseline"`
+	Total         UsageTotals      `json:"total"`
+	Delta         UsageTotals      `json:"delta"`
+	Items         []UsageEventItem `json:"items"`
+}
+
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+	// ChangedOnly skips users whose usage did not change since their previous
+	// event.
+	ChangedOnly bool
+	TLS         bool
+	// SASLMechanism is "plain", "scram-sha-256", "scram-sha-512" or empty for
+	// none.
+	SASLMechanism string
+	Username      string
+	Password      string
+	// Calendar decides which billing period an event belongs to.
+	Calendar billing.Calendar
+	// StateFile, if set, keeps the totals last sent per user across restarts
+	// and reloads, so deltas continue where they left off.
+	StateFile string
+}
+
+// kafkaSent is the total last published for a user, and in which period.
+type kafkaSent struct {
+	Period time.Time   `json:"period"`
+	Total  UsageTotals `json:"total"`
+}
+
+// Kafka publishes one UsageEvent per seat holder per cycle.
+type Kafka struct {
+	writer      *kafka.Writer
+	changedOnly bool
+	calendar    billing.Calendar
+	stateFile   string
+	sent        map[string]kafkaSent
+}
+
+func NewKafka(conf KafkaConfig) (*Kafka, error) {
+	transport := &kafka.Transport{}
+	if conf.TLS {
+		transport.TLS = &tls.Config{}
+	}
+	var mechanism sasl.Mechanism
+	var err error
+	switch conf.SASLMechanism {
+	case "":
+	case "plain":
+		mechanism = plain.Mechanism{Username: conf.Username, Password: conf.Password}
+	case "scram-sha-256":
+		mechanism, err = scram.Mechanism(scram.SHA256, conf.Username, conf.Password)
+	case "scram-sha-512":
+		mechanism, err = scram.Mechanism(scram.SHA512, conf.Username, conf.Password)
+	default:
+		return nil, fmt.Errorf("unknown kafka sasl mechanism %q", conf.SASLMechanism)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("configuring kafka sasl: %w", err)
+	}
+	transport.SASL = mechanism
+
+	sent, err := loadKafkaSent(conf.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Kafka{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(conf.Brokers...),
+			Topic:        conf.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transport,
+		},
+		changedOnly: conf.ChangedOnly,
+		calendar:    conf.Calendar,
+		stateFile:   conf.StateFile,
+		sent:        sent,
+	}, nil
+}
+
+func (k *Kafka) Name() string { return "kafka" }
+
+func (k *Kafka) Write(ctx context.Context, snap *snapshot.Snapshot) error {
+	events, sent := usageEvents(snap, k.calendar.MonthOf(snap.CollectedAt).Start, k.sent, k.changedOnly)
+	if len(events) > 0 {
+		messages := make([]kafka.Message, 0, len(events))
+		for _, e := range events {
+			value, err := json.Marshal(e)
+			if err != nil {
+				return fmt.Errorf("encoding usage event for %s: %w", e.User, err)
+			}
+			messages = append(messages, kafka.Message{Key: []byte(e.User), Value: value, Time: snap.CollectedAt})
+		}
+		if err := k.writer.WriteMessages(ctx, messages...); err != nil {
+			// Remember what did get delivered, or the next cycle sends it
+			// again with the same delta and consumers count it twice.
+			var failed kafka.WriteErrors
+			if !errors.As(err, &failed) || len(failed) != len(events) {
+				return fmt.Errorf("publishing %d usage events to kafka: %w", len(messages), err)
+			}
+			k.sent = delivered(k.sent, sent, events, failed)
+			err = fmt.Errorf("publishing %d of %d usage events to kafka: %w", failed.Count(), len(messages), err)
+			return errors.Join(err, saveKafkaSent(k.stateFile, k.sent))
+		}
+	}
+	k.sent = sent
+	return saveKafkaSent(k.stateFile, sent)
+}
+
+// usageEvents builds the event of each seat holder in snap for period, with
+// its delta from sent, skipping unchanged ones if changedOnly. It also
+// returns the totals to remember once the events are published; users who
+// lost their seat drop out, so their next event is a baseline.
+func usageEvents(snap *snapshot.Snapshot, period time.Time, sent map[string]kafkaSent, changedOnly bool) ([]*UsageEvent, map[string]kafkaSent) {
+	events := make(map[string]*UsageEvent, len(snap.Seats))
+	for _, seat := range snap.Seats {
+		events[seat.User] = &UsageEvent{
+			SchemaVersion: usageEventSchemaVersion,
+			Tenant:        snap.Tenant,
+			Enterprise:    snap.Enterprise,
+			User:          seat.User,
+			Team:          seat.Team,
+			PlanType:      seat.PlanType,
+			CollectedAt:   snap.CollectedAt,
+			PeriodStart:   period,
+			Items:         []UsageEventItem{},
+		}
+	}
+	for _, r := range snap.Records {
+		e, ok := events[r.User]
+		if !ok {
+			continue
+		}
+		e.Stale = e.Stale || r.Stale
+		e.Total.add(r)
+		var item UsageEventItem
+		item.SKU, item.Model = r.SKU, r.Model
+		item.add(r)
+		e.Items = append(e.Items, item)
+	}
+
+	var out []*UsageEvent
+	next := make(map[string]kafkaSent, len(events))
+	for _, seat := range snap.Seats {
+		e := events[seat.User]
+		next[e.User] = kafkaSent{Period: period, Total: e.Total}
+		if prev, ok := sent[e.User]; ok && prev.Period.Equal(period) {
+			e.Delta = e.Total.sub(prev.Total)
+			if changedOnly && e.Delta == (UsageTotals{}) {
+				continue
+			}
+		} else {
+			e.Delta, e.Baseline = e.Total, true
+		}
+		out = append(out, e)
+	}
+	return out, next
+}
+
+// delivered returns sent advanced to next for the users whose event was
+// published, going by the per-message errors of a partly failed write.
+func delivered(sent, next map[string]kafkaSent, events []*UsageEvent, failed kafka.WriteErrors) map[string]kafkaSent {
+	out := maps.Clone(sent)
+	for i, e := range events {
+		if failed[i] == nil {
+			out[e.User] = next[e.User]
+		}
+	}
+	return out
+}
+
+// loadKafkaSent reads the totals saved by saveKafkaSent to path. Without a
+// path or a file every user starts with a baseline event.
+func loadKafkaSent(path string) (map[string]kafkaSent, error) {
+	sent := make(map[string]kafkaSent)
+	if path == "" {
+		return sent, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return sent, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading kafka state: %w", err)
+	}
+	if err := json.Unmarshal(data, &sent); err != nil {
+		return nil, fmt.Errorf("decoding kafka state %s: %w", path, err)
+	}
+	return sent, nil
+}
+
+// saveKafkaSent writes sent to path, if set. The file is only replaced once
+// complete, so a crash mid-write keeps the previous totals.
+func saveKafkaSent(path string, sent map[string]kafkaSent) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(sent)
+	if err != nil {
+		return fmt.Errorf("encoding kafka state: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing kafka state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing kafka state: %w", err)
+	}
+	return nil
+}
+
+func (k *Kafka) Close() error { return k.writer.Close() }
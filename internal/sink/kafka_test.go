@@ -0,0 +1,160 @@
+package sink
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+)
+
+func TestUsageEvents(t *testing.T) {
+	march := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	april := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	totals := func(gross float64) UsageTotals {
+		return UsageTotals{GrossQuantity: gross * 25, NetQuantity: gross * 25, GrossAmount: gross, NetAmount: gross}
+	}
+	snap := func(usage map[string]float64, users ...string) *snapshot.Snapshot {
+		s := &snapshot.Snapshot{Enterprise: "acme", CollectedAt: march.Add(48 * time.Hour)}
+		for _, user := range users {
+			s.Seats = append(s.Seats, snapshot.Seat{User: user})
+			if gross, ok := usage[user]; ok {
+				u := totals(gross)
+				s.Records = append(s.Records, snapshot.Record{
+					User: user, Model: "GPT-5",
+					GrossQuantity: u.GrossQuantity, NetQuantity: u.NetQuantity, GrossAmount: u.GrossAmount, NetAmount: u.NetAmount,
+				})
+			}
+		}
+		return s
+	}
+
+	type event struct {
+		user     string
+		delta    UsageTotals
+		baseline bool
+	}
+	tests := []struct {
+		name        string
+		snap        *snapshot.Snapshot
+		period      time.Time
+		sent        map[string]kafkaSent
+		changedOnly bool
+		want        []event
+		wantSent    map[string]kafkaSent
+	}{
+		{
+			name:     "first events are baselines",
+			snap:     snap(map[string]float64{"a": 2}, "a", "b"),
+			period:   march,
+			sent:     map[string]kafkaSent{},
+			want:     []event{{"a", totals(2), true}, {"b", UsageTotals{}, true}},
+			wantSent: map[string]kafkaSent{"a": {march, totals(2)}, "b": {march, UsageTotals{}}},
+		},
+		{
+			name:     "delta since previous event",
+			snap:     snap(map[string]float64{"a": 5}, "a"),
+			period:   march,
+			sent:     map[string]kafkaSent{"a": {march, totals(2)}},
+			want:     []event{{"a", totals(3), false}},
+			wantSent: map[string]kafkaSent{"a": {march, totals(5)}},
+		},
+		{
+			name:     "new period starts over",
+			snap:     snap(map[string]float64{"a": 1}, "a"),
+			period:   april,
+			sent:     map[string]kafkaSent{"a": {march, totals(7)}},
+			want:     []event{{"a", totals(1), true}},
+			wantSent: map[string]kafkaSent{"a": {april, totals(1)}},
+		},
+		{
+			name:        "changed only skips unchanged users",
+			snap:        snap(map[string]float64{"a": 2, "b": 4}, "a", "b"),
+			period:      march,
+			sent:        map[string]kafkaSent{"a": {march, totals(2)}, "b": {march, totals(3)}},
+			changedOnly: true,
+			want:        []event{{"b", totals(1), false}},
+			wantSent:    map[string]kafkaSent{"a": {march, totals(2)}, "b": {march, totals(4)}},
+		},
+		{
+			name:        "changed only still sends baselines",
+			snap:        snap(nil, "a"),
+			period:      march,
+			sent:        map[string]kafkaSent{},
+			changedOnly: true,
+			want:        []event{{"a", UsageTotals{}, true}},
+			wantSent:    map[string]kafkaSent{"a": {march, UsageTotals{}}},
+		},
+		{
+			name:     "users without a seat are forgotten",
+			snap:     snap(map[string]float64{"a": 2}, "a"),
+			period:   march,
+			sent:     map[string]kafkaSent{"a": {march, totals(2)}, "gone": {march, totals(9)}},
+			want:     []event{{"a", UsageTotals{}, false}},
+			wantSent: map[string]kafkaSent{"a": {march, totals(2)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, sent := usageEvents(tt.snap, tt.period, tt.sent, tt.changedOnly)
+			var got []event
+			for _, e := range events {
+				if !e.PeriodStart.Equal(tt.period) {
+					t.Errorf("%s: PeriodStart = %s, want %s", e.User, e.PeriodStart, tt.period)
+				}
+				got = append(got, event{e.User, e.Delta, e.Baseline})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(sent, tt.wantSent) {
+				t.Errorf("sent = %+v, want %+v", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestKafkaSentRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.kafka.json")
+	march := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	sent, err := loadKafkaSent(path)
+	if err != nil {
+		t.Fatalf("loading missing state: %v", err)
+	}
+	if len(sent) != 0 {
+		t.Fatalf("missing state loaded %v, want nothing", sent)
+	}
+
+	want := map[string]kafkaSent{"a": {march, UsageTotals{GrossQuantity: 3, GrossAmount: 0.12}}}
+	if err := saveKafkaSent(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadKafkaSent(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+}
+
+func TestDelivered(t *testing.T) {
+	march := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(gross float64) kafkaSent { return kafkaSent{march, UsageTotals{GrossAmount: gross}} }
+	sent := map[string]kafkaSent{"a": at(1), "b": at(2), "c": at(3)}
+	next := map[string]kafkaSent{"a": at(4), "b": at(5), "c": at(3)}
+	events := []*UsageEvent{{User: "a"}, {User: "b"}}
+
+	got := delivered(sent, next, events, kafka.WriteErrors{nil, errors.New("broker down")})
+	want := map[string]kafkaSent{"a": at(4), "b": at(2), "c": at(3)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered = %+v, want %+v", got, want)
+	}
+	if sent["a"] != at(1) {
+		t.Errorf("delivered changed the previous state")
+	}
+}
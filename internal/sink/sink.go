@@ -0,0 +1,90 @@
+// Package sink forwards the snapshot published by each collection cycle to
+// systems outside Prometheus, such as data warehouses.
+package sink
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/logctx"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+	"go.uber.org/zap"
+)
+
+// Sink receives every published snapshot.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, snap *snapshot.Snapshot) error
+	Close() error
+}
+
+// writeTimeout bounds each sink's write so an unreachable destination delays
+// the next cycle by at most this much.
+const writeTimeout = 2 * time.Minute
+
+// Fanout writes each snapshot to every sink in turn. A failing sink is logged
+// and skipped so one unavailable destination never holds up the others.
+type Fanout struct {
+	sinks  []Sink
+	logger *zap.Logger
+}
+
+func NewFanout(logger *zap.Logger, sinks ...Sink) *Fanout {
+	return &Fanout{sinks: sinks, logger: logger}
+}
+
+func (f *Fanout) Write(ctx context.Context, snap *snapshot.Snapshot) {
+	for _, s := range f.sinks {
+		writeCtx, cancel := context.WithTimeout(ctx, writeTimeout)
+		err := s.Write(writeCtx, snap)
+		cancel()
+		if err != nil {
+			logctx.From(ctx, f.logger).Warn("sink write failed", zap.String("sink", s.Name()), zap.Error(err))
+		}
+	}
+}
+
+func (f *Fanout) Close() error {
+	var errs []error
+	for _, s := range f.sinks {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// UsageRow is the flat, one-row-per-usage-item shape the warehouse and
+// archive sinks write.
+type UsageRow struct {
+	CollectedAt    time.Time `bigquery:"collected_at" parquet:"collected_at,timestamp(millisecond)"`
+	Tenant         string    `bigquery:"tenant" parquet:"tenant,dict"`
+	Enterprise     string    `bigquery:"enterprise" parquet:"enterprise,dict"`
+	User           string    `bigquery:"user" parquet:"user,dict"`
+	SKU            string    `bigquery:"sku" parquet:"sku,dict"`
+	Model          string    `bigquery:"model" parquet:"model,dict"`
+	GrossQuantity  float64   `bigquery:"gross_quantity" parquet:"gross_quantity"`
+	NetQuantity    float64   `bigquery:"net_quantity" parquet:"net_quantity"`
+	GrossAmount    float64   `bigquery:"gross_amount" parquet:"gross_amount"`
+	DiscountAmount float64   `bigquery:"discount_amount" parquet:"discount_amount"`
+	NetAmount      float64   `bigquery:"net_amount" parquet:"net_amount"`
+}
+
+func usageRows(snap *snapshot.Snapshot) []UsageRow {
+	rows := make([]UsageRow, len(snap.Records))
+	for i, r := range snap.Records {
+		rows[i] = UsageRow{
+			CollectedAt:    snap.CollectedAt,
+			Tenant:         snap.Tenant,
+			Enterprise:     snap.Enterprise,
+			User:           r.User,
+			SKU:            r.SKU,
+			Model:          r.Model,
+			GrossQuantity:  r.GrossQuantity,
+			NetQuantity:    r.NetQuantity,
+			GrossAmount:    r.GrossAmount,
+			DiscountAmount: r.DiscountAmount,
+			NetAmount:      r.NetAmount,
+		}
+	}
+	return rows
+}
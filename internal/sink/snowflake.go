@@ -0,0 +1,81 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	_ "github.com/snowflakedb/gosnowflake"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+)
+
+// snowflakeBatch is how many rows go into each multi-row INSERT, so a large
+// enterprise loads in a few dozen round trips instead of one per row.
+const snowflakeBatch = 1000
+
+// snowflakeColumns is the number of UsageRow columns each row binds.
+const snowflakeColumns = 11
+
+// Snowflake appends every snapshot to an existing table with the UsageRow
+// columns, in one transaction per snapshot.
+type Snowflake struct {
+	db     *sql.DB
+	insert string
+}
+
+// NewSnowflake only validates dsn; the connection is opened by the first
+// Write.
+func NewSnowflake(dsn, table string) (*Snowflake, error) {
+	db, err := sql.Open("snowflake", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening snowflake: %w", err)
+	}
+	return &Snowflake{
+		db: db,
+		insert: fmt.Sprintf("INSERT INTO %s (collected_at, tenant, enterprise, user, sku, model, "+
+			"gross_quantity, net_quantity, gross_amount, discount_amount, net_amount) VALUES ", table),
+	}, nil
+}
+
+func (s *Snowflake) Name() string { return "snowflake" }
+
+func (s *Snowflake) Write(ctx context.Context, snap *snapshot.Snapshot) error {
+	rows := usageRows(snap)
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning snowflake transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	args := make([]any, 0, min(len(rows), snowflakeBatch)*snowflakeColumns)
+	first := 0
+	for chunk := range slices.Chunk(rows, snowflakeBatch) {
+		args = args[:0]
+		for _, r := range chunk {
+			args = append(args, r.CollectedAt, r.Tenant, r.Enterprise, r.User, r.SKU, r.Model,
+				r.GrossQuantity, r.NetQuantity, r.GrossAmount, r.DiscountAmount, r.NetAmount)
+		}
+		if _, err := tx.ExecContext(ctx, s.insertRows(len(chunk)), args...); err != nil {
+			return fmt.Errorf("inserting rows %d-%d of %d into snowflake: %w", first+1, first+len(chunk), len(rows), err)
+		}
+		first += len(chunk)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing snowflake transaction: %w", err)
+	}
+	return nil
+}
+
+// insertRows returns the INSERT statement binding n rows.
+func (s *Snowflake) insertRows(n int) string {
+	row := "(" + strings.Repeat("?, ", snowflakeColumns-1) + "?)"
+	return s.insert + strings.Join(slices.Repeat([]string{row}, n), ", ")
+}
+
+func (s *Snowflake) Close() error { return s.db.Close() }
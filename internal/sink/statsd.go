@@ -0,0 +1,57 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+)
+
+// StatsD emits the registry's gauges to a DogStatsD agent after every cycle,
+// tagged with their Prometheus labels plus Tags.
+type StatsD struct {
+	client      *statsd.Client
+	gatherer    prometheus.Gatherer
+	processWide bool
+}
+
+// NewStatsD sends to addr, a host:port for UDP or unix:///path for a socket.
+// In multi-tenant mode only the sink with processWide set sends the gauges
+// without a tenant label.
+func NewStatsD(addr string, tags []string, gatherer prometheus.Gatherer, processWide bool) (*StatsD, error) {
+	client, err := statsd.New(addr, statsd.WithTags(tags))
+	if err != nil {
+		return nil, fmt.Errorf("creating statsd client: %w", err)
+	}
+	return &StatsD{client: client, gatherer: gatherer, processWide: processWide}, nil
+}
+
+func (s *StatsD) Name() string { return "statsd" }
+
+func (s *StatsD) Write(ctx context.Context, snap *snapshot.Snapshot) error {
+	series, err := gauges(s.gatherer, snap.Tenant, s.processWide)
+	if err != nil {
+		return err
+	}
+	// Keep sending after a failure; report the first one.
+	var failed int
+	for _, g := range series {
+		if gaugeErr := s.client.Gauge(g.name, g.value, g.tags(nil), 1); gaugeErr != nil {
+			if err == nil {
+				err = gaugeErr
+			}
+			failed++
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("sending %d of %d gauges to statsd: %w", failed, len(series), err)
+	}
+	if err := s.client.Flush(); err != nil {
+		return fmt.Errorf("flushing statsd: %w", err)
+	}
+	return nil
+}
+
+func (s *StatsD) Close() error { return s.client.Close() }
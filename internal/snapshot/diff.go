@@ -0,0 +1,126 @@
+package snapshot
+
+import (
+	"cmp"
+	"maps"
+	"math"
+	"slices"
+)
+
+// Spend is what a user or model consumed in one snapshot.
+type Spend struct {
+	GrossQuantity float64 `json:"grossQuantity"`
+	GrossAmount   float64 `json:"grossAmount"`
+	NetAmount     float64 `json:"netAmount"`
+}
+
+func (s Spend) sub(o Spend) Spend {
+	return Spend{
+		GrossQuantity: s.GrossQuantity - o.GrossQuantity,
+		GrossAmount:   s.GrossAmount - o.GrossAmount,
+		NetAmount:     s.NetAmount - o.NetAmount,
+	}
+}
+
+// Change compares the spend of one key between two snapshots. Users are
+// keyed within their tenant, since a login can hold a seat in several;
+// models are compared across tenants.
+type Change struct {
+	Tenant string `json:"tenant,omitempty"`
+	Key    string `json:"key"`
+	From   Spend  `json:"from"`
+	To     Spend  `json:"to"`
+	Change Spend  `json:"change"`
+}
+
+// SeatHolder is a user of one tenant.
+type SeatHolder struct {
+	Tenant string `json:"tenant,omitempty"`
+	User   string `json:"user"`
+}
+
+// Diff is how usage changed from one snapshot to another.
+type Diff struct {
+	// Users and Models are ordered by the size of their net amount change,
+	// then of their gross amount change, biggest first.
+	Users  []Change `json:"users"`
+	Models []Change `json:"models"`
+	// NewUsers hold a seat in to but not in from; DroppedUsers the reverse.
+	NewUsers     []SeatHolder `json:"newUsers"`
+	DroppedUsers []SeatHolder `json:"droppedUsers"`
+}
+
+// Compare returns how usage changed from from to to.
+func Compare(from, to *Snapshot) Diff {
+	return Diff{
+		Users:        changes(from, to, func(r Record) (string, string) { return r.Tenant, r.User }),
+		Models:       changes(from, to, func(r Record) (string, string) { return "", r.Model }),
+		NewUsers:     missingSeats(to, from),
+		DroppedUsers: missingSeats(from, to),
+	}
+}
+
+// changes compares the spend of from and to grouped by the tenant and key
+// that key returns for each record.
+func changes(from, to *Snapshot, key func(Record) (tenant, key string)) []Change {
+	type changeKey struct{ tenant, key string }
+	byKey := make(map[changeKey]*Change)
+	add := func(r Record, spend func(*Change) *Spend) {
+		var k changeKey
+		k.tenant, k.key = key(r)
+		c, ok := byKey[k]
+		if !ok {
+			c = &Change{Tenant: k.tenant, Key: k.key}
+			byKey[k] = c
+		}
+		s := spend(c)
+		s.GrossQuantity += r.GrossQuantity
+		s.GrossAmount += r.GrossAmount
+		s.NetAmount += r.NetAmount
+	}
+	for _, r := range from.Records {
+		add(r, func(c *Change) *Spend { return &c.From })
+	}
+	for _, r := range to.Records {
+		add(r, func(c *Change) *Spend { return &c.To })
+	}
+
+	out := make([]Change, 0, len(byKey))
+	for _, c := range byKey {
+		c.Change = c.To.sub(c.From)
+		out = append(out, *c)
+	}
+	slices.SortFunc(out, func(a, b Change) int {
+		if c := cmp.Compare(math.Abs(b.Change.NetAmount), math.Abs(a.Change.NetAmount)); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(math.Abs(b.Change.GrossAmount), math.Abs(a.Change.GrossAmount)); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Tenant, b.Tenant); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return out
+}
+
+// missingSeats returns the seat holders of a that hold no seat in b, sorted
+// by tenant, then user.
+func missingSeats(a, b *Snapshot) []SeatHolder {
+	inB := make(map[SeatHolder]bool, len(b.Seats))
+	for _, s := range b.Seats {
+		inB[SeatHolder{Tenant: s.Tenant, User: s.User}] = true
+	}
+	missing := make(map[SeatHolder]bool)
+	for _, s := range a.Seats {
+		if h := (SeatHolder{Tenant: s.Tenant, User: s.User}); !inB[h] {
+			missing[h] = true
+		}
+	}
+	holders := slices.AppendSeq(make([]SeatHolder, 0, len(missing)), maps.Keys(missing))
+	slices.SortFunc(holders, func(a, b SeatHolder) int {
+		return cmp.Or(cmp.Compare(a.Tenant, b.Tenant), cmp.Compare(a.User, b.User))
+	})
+	return holders
+}
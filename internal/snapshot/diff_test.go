@@ -0,0 +1,105 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	rec := func(tenant, user, model string, gross, net float64) Record {
+		return Record{Tenant: tenant, User: user, Model: model, GrossQuantity: gross * 25, GrossAmount: gross, NetAmount: net}
+	}
+	seat := func(tenant, user string) Seat { return Seat{Tenant: tenant, User: user} }
+	spend := func(gross, net float64) Spend {
+		return Spend{GrossQuantity: gross * 25, GrossAmount: gross, NetAmount: net}
+	}
+
+	tests := []struct {
+		name     string
+		from, to *Snapshot
+		want     Diff
+	}{
+		{
+			name: "no change",
+			from: &Snapshot{Seats: []Seat{seat("", "a")}, Records: []Record{rec("", "a", "GPT-5", 1, 0)}},
+			to:   &Snapshot{Seats: []Seat{seat("", "a")}, Records: []Record{rec("", "a", "GPT-5", 1, 0)}},
+			want: Diff{
+				Users:        []Change{{Key: "a", From: spend(1, 0), To: spend(1, 0)}},
+				Models:       []Change{{Key: "GPT-5", From: spend(1, 0), To: spend(1, 0)}},
+				NewUsers:     []SeatHolder{},
+				DroppedUsers: []SeatHolder{},
+			},
+		},
+		{
+			name: "ordered by net then gross change",
+			from: &Snapshot{Records: []Record{rec("", "a", "GPT-5", 1, 0), rec("", "b", "GPT-5", 1, 0), rec("", "c", "o3", 1, 0)}},
+			to:   &Snapshot{Records: []Record{rec("", "a", "GPT-5", 3, 0), rec("", "b", "GPT-5", 2, 1), rec("", "c", "o3", 1, 0)}},
+			want: Diff{
+				Users: []Change{
+					{Key: "b", From: spend(1, 0), To: spend(2, 1), Change: spend(1, 1)},
+					{Key: "a", From: spend(1, 0), To: spend(3, 0), Change: spend(2, 0)},
+					{Key: "c", From: spend(1, 0), To: spend(1, 0)},
+				},
+				Models: []Change{
+					{Key: "GPT-5", From: spend(2, 0), To: spend(5, 1), Change: spend(3, 1)},
+					{Key: "o3", From: spend(1, 0), To: spend(1, 0)},
+				},
+				NewUsers:     []SeatHolder{},
+				DroppedUsers: []SeatHolder{},
+			},
+		},
+		{
+			name: "decrease counts by its size",
+			from: &Snapshot{Records: []Record{rec("", "a", "o3", 5, 4), rec("", "b", "o3", 1, 1)}},
+			to:   &Snapshot{Records: []Record{rec("", "a", "o3", 1, 1), rec("", "b", "o3", 2, 2)}},
+			want: Diff{
+				Users: []Change{
+					{Key: "a", From: spend(5, 4), To: spend(1, 1), Change: spend(-4, -3)},
+					{Key: "b", From: spend(1, 1), To: spend(2, 2), Change: spend(1, 1)},
+				},
+				Models:       []Change{{Key: "o3", From: spend(6, 5), To: spend(3, 3), Change: spend(-3, -2)}},
+				NewUsers:     []SeatHolder{},
+				DroppedUsers: []SeatHolder{},
+			},
+		},
+		{
+			name: "same login in two tenants",
+			from: &Snapshot{
+				Seats:   []Seat{seat("alpha", "a"), seat("beta", "a")},
+				Records: []Record{rec("alpha", "a", "o3", 1, 0), rec("beta", "a", "o3", 1, 0)},
+			},
+			to: &Snapshot{
+				Seats:   []Seat{seat("alpha", "a"), seat("gamma", "a")},
+				Records: []Record{rec("alpha", "a", "o3", 3, 0), rec("gamma", "a", "o3", 2, 0)},
+			},
+			want: Diff{
+				Users: []Change{
+					{Tenant: "alpha", Key: "a", From: spend(1, 0), To: spend(3, 0), Change: spend(2, 0)},
+					{Tenant: "gamma", Key: "a", To: spend(2, 0), Change: spend(2, 0)},
+					{Tenant: "beta", Key: "a", From: spend(1, 0), Change: spend(-1, 0)},
+				},
+				Models:       []Change{{Key: "o3", From: spend(2, 0), To: spend(5, 0), Change: spend(3, 0)}},
+				NewUsers:     []SeatHolder{{Tenant: "gamma", User: "a"}},
+				DroppedUsers: []SeatHolder{{Tenant: "beta", User: "a"}},
+			},
+		},
+		{
+			name: "seats without usage",
+			from: &Snapshot{Seats: []Seat{seat("", "b"), seat("", "a")}},
+			to:   &Snapshot{Seats: []Seat{seat("", "c"), seat("", "d"), seat("", "a")}},
+			want: Diff{
+				Users:        []Change{},
+				Models:       []Change{},
+				NewUsers:     []SeatHolder{{User: "c"}, {User: "d"}},
+				DroppedUsers: []SeatHolder{{User: "b"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compare(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compare() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
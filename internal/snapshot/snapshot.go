@@ -0,0 +1,225 @@
+// Package snapshot keeps the usage published by the latest collection cycle
+// in memory so HTTP endpoints can answer questions that are awkward to ask of
+// the Prometheus series, such as ranking spenders.
+package snapshot
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Record is one usage item of one user.
+type Record struct {
+	Tenant         string  `json:"tenant,omitempty"`
+	User           string  `json:"user"`
+	Team           string  `json:"team"`
+	PlanType       string  `json:"planType"`
+	SKU            string  `json:"sku"`
+	Model          string  `json:"model"`
+	Stale          bool    `json:"stale"`
+	GrossQuantity  float64 `json:"grossQuantity"`
+	NetQuantity    float64 `json:"netQuantity"`
+	GrossAmount    float64 `json:"grossAmount"`
+	DiscountAmount float64 `json:"discountAmount"`
+	NetAmount      float64 `json:"netAmount"`
+}
+
+// Seat is a seat holder, listed whether or not they have any usage.
+type Seat struct {
+	Tenant   string `json:"tenant,omitempty"`
+	User     string `json:"user"`
+	Team     string `json:"team"`
+	PlanType string `json:"planType"`
+}
+
+type Snapshot struct {
+	Tenant      string    `json:"tenant,omitempty"`
+	Enterprise  string    `json:"enterprise"`
+	CollectedAt time.Time `json:"collectedAt"`
+	Seats       []Seat    `json:"seats"`
+	Records     []Record  `json:"records"`
+}
+
+// Store holds the latest snapshot of each tenant. The zero value is empty and
+// ready to use.
+type Store struct {
+	mu     sync.Mutex // serializes Set
+	latest atomic.Pointer[map[string]*Snapshot]
+}
+
+// Set replaces the latest snapshot of snap.Tenant.
+func (s *Store) Set(snap *Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latest := make(map[string]*Snapshot)
+	if prev := s.latest.Load(); prev != nil {
+		maps.Copy(latest, *prev)
+	}
+	latest[snap.Tenant] = snap
+	s.latest.Store(&latest)
+}
+
+// Tenant returns the most recent snapshot of tenant, or nil before its first
+// cycle has completed. Snapshots are never modified once stored.
+func (s *Store) Tenant(tenant string) *Snapshot {
+	latest := s.latest.Load()
+	if latest == nil {
+		return nil
+	}
+	return (*latest)[tenant]
+}
+
+// Latest returns the most recent snapshot, or nil before the first cycle has
+// completed. With several tenants it is their snapshots merged by Merge.
+func (s *Store) Latest() *Snapshot {
+	latest := s.latest.Load()
+	if latest == nil {
+		return nil
+	}
+	return Merge(*latest)
+}
+
+// Merge combines the snapshots of several tenants, keyed by tenant, in tenant
+// order. The result is collected at the oldest of their times and its
+// enterprise lists every tenant's. A single snapshot is returned as is.
+func Merge(snaps map[string]*Snapshot) *Snapshot {
+	if len(snaps) == 1 {
+		for _, snap := range snaps {
+			return snap
+		}
+	}
+	merged := &Snapshot{}
+	var enterprises []string
+	for _, tenant := range slices.Sorted(maps.Keys(snaps)) {
+		snap := snaps[tenant]
+		if merged.CollectedAt.IsZero() || snap.CollectedAt.Before(merged.CollectedAt) {
+			merged.CollectedAt = snap.CollectedAt
+		}
+		if !slices.Contains(enterprises, snap.Enterprise) {
+			enterprises = append(enterprises, snap.Enterprise)
+		}
+		merged.Seats = append(merged.Seats, snap.Seats...)
+		merged.Records = append(merged.Records, snap.Records...)
+	}
+	merged.Enterprise = strings.Join(enterprises, ",")
+	return merged
+}
+
+// Group is the aggregate of the records sharing a key. Users are grouped per
+// tenant, so the same login in two tenants is two groups told apart by Tenant.
+type Group struct {
+	Rank           int     `json:"rank"`
+	Tenant         string  `json:"tenant,omitempty"`
+	Key            string  `json:"key"`
+	Users          int     `json:"users"`
+	GrossQuantity  float64 `json:"grossQuantity"`
+	NetQuantity    float64 `json:"netQuantity"`
+	GrossAmount    float64 `json:"grossAmount"`
+	DiscountAmount float64 `json:"discountAmount"`
+	NetAmount      float64 `json:"netAmount"`
+}
+
+var groupKeys = map[string]func(Record) string{
+	"user":   func(r Record) string { return r.User },
+	"tenant": func(r Record) string { return r.Tenant },
+	"team":   func(r Record) string { return r.Team },
+	"model":  func(r Record) string { return r.Model },
+}
+
+var measures = map[string]func(Group) float64{
+	"net_amount":     func(g Group) float64 { return g.NetAmount },
+	"gross_amount":   func(g Group) float64 { return g.GrossAmount },
+	"net_quantity":   func(g Group) float64 { return g.NetQuantity },
+	"gross_quantity": func(g Group) float64 { return g.GrossQuantity },
+}
+
+// Top aggregates the snapshot by groupBy ("user", "team", "model" or "tenant") and
+// returns the n largest groups by the measure named by by, e.g.
+// "net_amount". Ties are broken by key so the ranking is stable.
+func (s *Snapshot) Top(n int, by, groupBy string) ([]Group, error) {
+	key, ok := groupKeys[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown group_by %q, expected one of %s", groupBy, strings.Join(sortedKeys(groupKeys), ", "))
+	}
+	measure, ok := measures[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown by %q, expected one of %s", by, strings.Join(sortedKeys(measures), ", "))
+	}
+
+	type groupKey struct{ tenant, key string }
+	groups := make(map[groupKey]*Group)
+	users := make(map[groupKey]map[userKey]bool)
+	for _, r := range s.Records {
+		k := groupKey{key: key(r)}
+		if groupBy == "user" {
+			k.tenant = r.Tenant
+		}
+		g, ok := groups[k]
+		if !ok {
+			g = &Group{Tenant: k.tenant, Key: k.key}
+			groups[k] = g
+			users[k] = make(map[userKey]bool)
+		}
+		g.GrossQuantity += r.GrossQuantity
+		g.NetQuantity += r.NetQuantity
+		g.GrossAmount += r.GrossAmount
+		g.DiscountAmount += r.DiscountAmount
+		g.NetAmount += r.NetAmount
+		users[k][userKey{r.Tenant, r.User}] = true
+	}
+
+	ranked := make([]Group, 0, len(groups))
+	for k, g := range groups {
+		g.Users = len(users[k])
+		ranked = append(ranked, *g)
+	}
+	slices.SortFunc(ranked, func(a, b Group) int {
+		if ma, mb := measure(a), measure(b); ma != mb {
+			if ma > mb {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(strings.Compare(a.Key, b.Key), strings.Compare(a.Tenant, b.Tenant))
+	})
+
+	ranked = ranked[:min(n, len(ranked))]
+	for i := range ranked {
+		ranked[i].Rank = i + 1
+	}
+	return ranked, nil
+}
+
+// Total aggregates every record of the snapshot into one group without a key.
+func (s *Snapshot) Total() Group {
+	var total Group
+	users := make(map[userKey]bool)
+	for _, r := range s.Records {
+		total.GrossQuantity += r.GrossQuantity
+		total.NetQuantity += r.NetQuantity
+		total.GrossAmount += r.GrossAmount
+		total.DiscountAmount += r.DiscountAmount
+		total.NetAmount += r.NetAmount
+		users[userKey{r.Tenant, r.User}] = true
+	}
+	total.Users = len(users)
+	return total
+}
+
+// userKey identifies a user across tenants, where logins may repeat.
+type userKey struct{ tenant, user string }
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,42 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopKeepsTenantsApart(t *testing.T) {
+	snap := Merge(map[string]*Snapshot{
+		"eu": {Tenant: "eu", Records: []Record{
+			{Tenant: "eu", User: "alice", Team: "web", NetAmount: 3},
+			{Tenant: "eu", User: "bob", Team: "web", NetAmount: 1},
+		}},
+		"us": {Tenant: "us", Records: []Record{
+			{Tenant: "us", User: "alice", Team: "web", NetAmount: 2},
+		}},
+	})
+
+	users, err := snap.Top(10, "net_amount", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Group{
+		{Rank: 1, Tenant: "eu", Key: "alice", Users: 1, NetAmount: 3},
+		{Rank: 2, Tenant: "us", Key: "alice", Users: 1, NetAmount: 2},
+		{Rank: 3, Tenant: "eu", Key: "bob", Users: 1, NetAmount: 1},
+	}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("users = %+v, want %+v", users, want)
+	}
+
+	teams, err := snap.Top(10, "net_amount", "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(teams) != 1 || teams[0].Users != 3 {
+		t.Errorf("teams = %+v, want one team of 3 users", teams)
+	}
+	if total := snap.Total(); total.Users != 3 {
+		t.Errorf("total has %d users, want 3", total.Users)
+	}
+}
@@ -0,0 +1,53 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/github"
+)
+
+// Recording is the replay file format. Seats and each entry of Usage are the
+// bodies of the corresponding GitHub REST responses, so a recording can be
+// assembled from saved API output.
+type Recording struct {
+	Seats github.SeatsResponse            `json:"seats"`
+	Usage map[string]github.UsageResponse `json:"usage"`
+}
+
+// Replay serves a Recording read from a file, for reproducing a cycle
+// offline. The file is reread on every ListSeats so edits take effect on the
+// next cycle.
+type Replay struct {
+	path      string
+	recording Recording
+}
+
+func NewReplay(path string) *Replay {
+	return &Replay{path: path}
+}
+
+func (r *Replay) ListSeats(ctx context.Context, enterprise string) ([]github.CopilotSeat, int, error) {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading replay file: %w", err)
+	}
+	var recording Recording
+	if err := json.Unmarshal(data, &recording); err != nil {
+		return nil, 0, fmt.Errorf("parsing replay file %s: %w", r.path, err)
+	}
+	r.recording = recording
+	return recording.Seats.Seats, recording.Seats.TotalSeats, nil
+}
+
+// GetUsage returns the recorded usage of user. Seat holders missing from
+// Usage have none, so recordings can leave out idle users.
+func (r *Replay) GetUsage(ctx context.Context, enterprise, user string) (*github.UsageResponse, error) {
+	usage, ok := r.recording.Usage[user]
+	if !ok {
+		return &github.UsageResponse{Enterprise: enterprise, User: user}, nil
+	}
+	return &usage, nil
+}
@@ -0,0 +1,52 @@
+// Package source abstracts where collection reads seats and usage from, so
+// the REST client can be swapped for another backend such as a recorded
+// replay.
+package source
+
+import (
+	"context"
+
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/github"
+)
+
+// UsageSource lists an enterprise's Copilot seats and each seat holder's
+// month-to-date premium request usage.
+type UsageSource interface {
+	// ListSeats also returns the total number of seats the backend reports,
+	// which may differ from the number listed when a listing is incomplete.
+	ListSeats(ctx context.Context, enterprise string) ([]github.CopilotSeat, int, error)
+	GetUsage(ctx context.Context, enterprise, user string) (*github.UsageResponse, error)
+}
+
+var _ UsageSource = (*github.Client)(nil)
+
+// Preflighter is implemented by sources that can validate their
+// configuration before the first collection.
+type Preflighter interface {
+	Preflight(ctx context.Context, enterprise string) error
+}
+
+var _ Preflighter = (*github.Client)(nil)
+
+// SeatPager is implemented by sources that can list seats a page at a time,
+// so collecting a large enterprise never holds all of its seats at once.
+type SeatPager interface {
+	// EachSeatPage calls fn with every page of seats in turn and the total
+	// number of seats the backend reports. fn must not keep the slice.
+	EachSeatPage(ctx context.Context, enterprise string, fn func(seats []github.CopilotSeat, total int) error) error
+}
+
+var _ SeatPager = (*github.Client)(nil)
+
+// EachSeatPage lists src's seats through fn a page at a time if src is a
+// SeatPager, or as a single page otherwise.
+func EachSeatPage(ctx context.Context, src UsageSource, enterprise string, fn func(seats []github.CopilotSeat, total int) error) error {
+	if p, ok := src.(SeatPager); ok {
+		return p.EachSeatPage(ctx, enterprise, fn)
+	}
+	seats, total, err := src.ListSeats(ctx, enterprise)
+	if err != nil {
+		return err
+	}
+	return fn(seats, total)
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// savedSeries is one series of a MetricSet as encoded by Encode. Histogram
+// buckets are cumulative counts in the family's bucket order.
+type savedSeries struct {
+	Family  string   `json:"family"`
+	Labels  []string `json:"labels"`
+	Value   float64  `json:"value,omitempty"`
+	Count   uint64   `json:"count,omitempty"`
+	Sum     float64  `json:"sum,omitempty"`
+	Buckets []uint64 `json:"buckets,omitempty"`
+}
+
+// Encode writes every series of s to enc, one value per series, so a set can
+// be written out without holding a second copy of it. It does not consume s.
+func (s *MetricSet) Encode(enc *json.Encoder) error {
+	for f, series := range s.gauges {
+		for _, g := range series {
+			if err := enc.Encode(savedSeries{Family: f.fqName, Labels: g.labelValues, Value: g.value}); err != nil {
+				return err
+			}
+		}
+	}
+	for f, series := range s.histograms {
+		for _, h := range series {
+			buckets := make([]uint64, len(f.buckets))
+			for i, upper := range f.buckets {
+				buckets[i] = h.buckets[upper]
+			}
+			if err := enc.Encode(savedSeries{Family: f.fqName, Labels: h.labelValues, Count: h.count, Sum: h.sum, Buckets: buckets}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DecodeMetricSet reads the series written by Encode into a new set for
+// tenant. Series of families that no longer exist, or whose labels or
+// buckets have changed since, are skipped and counted in skipped.
+func DecodeMetricSet(dec *json.Decoder, tenant string, collectedAt time.Time) (set *MetricSet, skipped int, err error) {
+	families := make(map[string]*Family, len(cycle.families))
+	for _, f := range cycle.families {
+		if f.descFor(tenant) == nil {
+			return nil, 0, fmt.Errorf("tenant %q is not configured", tenant)
+		}
+		families[f.fqName] = f
+	}
+
+	set = NewMetricSet(tenant, collectedAt)
+	for {
+		var saved savedSeries
+		if err := dec.Decode(&saved); errors.Is(err, io.EOF) {
+			return set, skipped, nil
+		} else if err != nil {
+			return nil, 0, err
+		}
+		f, ok := families[saved.Family]
+		if !ok || len(saved.Labels) != len(f.labels) {
+			skipped++
+			continue
+		}
+		if f.buckets == nil {
+			set.Set(f, saved.Value, saved.Labels...)
+			continue
+		}
+		if len(saved.Buckets) != len(f.buckets) {
+			skipped++
+			continue
+		}
+		series, ok := set.histograms[f]
+		if !ok {
+			series = make(map[string]*histogramSample)
+			set.histograms[f] = series
+		}
+		h := &histogramSample{labelValues: saved.Labels, count: saved.Count, sum: saved.Sum, buckets: make(map[float64]uint64, len(f.buckets))}
+		for i, upper := range f.buckets {
+			h.buckets[upper] = saved.Buckets[i]
+		}
+		series[seriesKey(saved.Labels)] = h
+	}
+}
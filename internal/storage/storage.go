@@ -0,0 +1,166 @@
+// Package storage writes exported artifacts such as chargeback statements to
+// a local directory or an object store bucket, addressed by a single URL.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Bucket stores objects under slash-separated keys.
+type Bucket interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Close() error
+}
+
+// Open returns the bucket for location: a plain path or file:// URL for a
+// local directory, s3://bucket/prefix, gs://bucket/prefix or
+// azblob://account/container/prefix. Credentials come from each cloud's
+// default chain, so IRSA, GKE and Azure workload identity all work.
+func Open(ctx context.Context, location string) (Bucket, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("parsing storage location %q: %w", location, err)
+	}
+
+	switch u.Scheme {
+	case "", "file":
+		dir := location
+		if u.Scheme == "file" {
+			dir = u.Path
+		}
+		return &Dir{path: dir}, nil
+	case "s3":
+		conf, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("loading aws configuration: %w", err)
+		}
+		return &S3{
+			client: s3.NewFromConfig(conf),
+			bucket: u.Host,
+			prefix: strings.Trim(u.Path, "/"),
+		}, nil
+	case "gs":
+		client, err := gcs.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("creating gcs client: %w", err)
+		}
+		return &GCS{client: client, bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+	case "azblob":
+		container, prefix, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+		if container == "" {
+			return nil, fmt.Errorf("missing container in %q", location)
+		}
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, fmt.Errorf("loading azure credentials: %w", err)
+		}
+		client, err := azblob.NewClient(fmt.Sprintf("https://%s.blob.core.windows.net/", u.Host), cred, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating azure blob client: %w", err)
+		}
+		return &Azure{client: client, container: container, prefix: prefix}, nil
+	default:
+		return nil, fmt.Errorf("unsupported storage scheme %q in %q", u.Scheme, location)
+	}
+}
+
+// Dir is a Bucket backed by a local directory. Objects are written to a
+// temporary file and renamed so readers never see a partial file.
+type Dir struct {
+	path string
+}
+
+func (d *Dir) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	target := filepath.Join(d.path, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("creating directory for %s: %w", target, err)
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return fmt.Errorf("renaming %s: %w", tmp, err)
+	}
+	return nil
+}
+
+func (d *Dir) Close() error { return nil }
+
+type S3 struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (b *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	key = path.Join(b.prefix, key)
+	_, err := b.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(b.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("uploading s3://%s/%s: %w", b.bucket, key, err)
+	}
+	return nil
+}
+
+func (b *S3) Close() error { return nil }
+
+type GCS struct {
+	client *gcs.Client
+	bucket string
+	prefix string
+}
+
+func (b *GCS) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	key = path.Join(b.prefix, key)
+	w := b.client.Bucket(b.bucket).Object(key).NewWriter(ctx)
+	w.ContentType = contentType
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("uploading gs://%s/%s: %w", b.bucket, key, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("uploading gs://%s/%s: %w", b.bucket, key, err)
+	}
+	return nil
+}
+
+func (b *GCS) Close() error { return b.client.Close() }
+
+type Azure struct {
+	client    *azblob.Client
+	container string
+	prefix    string
+}
+
+func (b *Azure) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	key = path.Join(b.prefix, key)
+	_, err := b.client.UploadBuffer(ctx, b.container, key, data, &azblob.UploadBufferOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+	})
+	if err != nil {
+		return fmt.Errorf("uploading %s/%s to azure blob storage: %w", b.container, key, err)
+	}
+	return nil
+}
+
+func (b *Azure) Close() error { return nil }
@@ -0,0 +1,112 @@
+// Package ui serves a read-only HTML page of the latest collection snapshot
+// for stakeholders who want the numbers but have no access to dashboards.
+package ui
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/audit"
+	"go.dfds.cloud/copilot-premium-usage-exporter/internal/snapshot"
+)
+
+//go:embed page.html
+var pageSource string
+
+var page = template.Must(template.New("page").Funcs(template.FuncMap{
+	"usd": func(v float64) string { return "$" + formatNumber(v, 2) },
+	"num": func(v float64) string { return formatNumber(v, 0) },
+	"age": func(d time.Duration) string { return d.Round(time.Second).String() },
+}).Parse(pageSource))
+
+// Health reports how collection is going: the summary of each tenant's most
+// recent cycle, and why the exporter is not ready, if it is not.
+type Health interface {
+	Cycles() []audit.Summary
+	NotReady() []string
+}
+
+type UI struct {
+	store  *snapshot.Store
+	health Health
+}
+
+func New(store *snapshot.Store, health Health) *UI {
+	return &UI{store: store, health: health}
+}
+
+// Register mounts the page at /ui on router and redirects / to it.
+func (u *UI) Register(router fiber.Router) {
+	router.Get("/", func(c *fiber.Ctx) error {
+		return c.Redirect("/ui", fiber.StatusFound)
+	})
+	router.Get("/ui", u.index)
+}
+
+type pageData struct {
+	Snapshot *snapshot.Snapshot
+	Age      time.Duration
+	Seats    int
+	Total    snapshot.Group
+	Tables   []groupTable
+	Cycles   []audit.Summary
+	NotReady []string
+}
+
+// groupTable lists the snapshot aggregated by the group key Key.
+type groupTable struct {
+	Title, Column, Key string
+	Groups             []snapshot.Group
+}
+
+func (u *UI) index(c *fiber.Ctx) error {
+	data := pageData{Cycles: u.health.Cycles(), NotReady: u.health.NotReady()}
+	if snap := u.store.Latest(); snap != nil {
+		data.Snapshot = snap
+		data.Age = time.Since(snap.CollectedAt)
+		data.Seats = len(snap.Seats)
+		data.Total = snap.Total()
+		for _, t := range []groupTable{
+			{Title: "Users", Column: "User", Key: "user"},
+			{Title: "Teams", Column: "Team", Key: "team"},
+			{Title: "Models", Column: "Model", Key: "model"},
+		} {
+			// The group keys and measure are known, so Top cannot fail.
+			t.Groups, _ = snap.Top(math.MaxInt, "net_amount", t.Key)
+			data.Tables = append(data.Tables, t)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := page.Execute(&out, data); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(out.Bytes())
+}
+
+// formatNumber formats v with decimals digits and thousands separators.
+func formatNumber(v float64, decimals int) string {
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	whole, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	if frac != "" {
+		b.WriteString("." + frac)
+	}
+	return b.String()
+}
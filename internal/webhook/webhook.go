@@ -0,0 +1,180 @@
+// Package webhook receives GitHub webhook deliveries about Copilot seat and
+// billing changes and turns them into recollection requests, so a change
+// shows up in the metrics within seconds instead of at the next interval.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// DefaultEvents are the X-GitHub-Event values acted on when none are
+// configured.
+var DefaultEvents = []string{"copilot_seat_assignment", "copilot_seat_cancellation", "enterprise_billing"}
+
+// Receiver verifies deliveries and accumulates the logins they affect until
+// the worker takes them. Deliveries that name no login, such as billing
+// events, request a full recollection, and seat assignments and
+// cancellations also mark the listed seats out of date.
+type Receiver struct {
+	secret []byte
+	events []string
+	logger *zap.Logger
+
+	mu        sync.Mutex
+	users     map[string]bool
+	all       bool
+	seats     bool
+	triggered chan struct{}
+}
+
+func New(secret string, events []string, logger *zap.Logger) *Receiver {
+	if len(events) == 0 {
+		events = DefaultEvents
+	}
+	return &Receiver{
+		secret:    []byte(secret),
+		events:    events,
+		logger:    logger,
+		users:     make(map[string]bool),
+		triggered: make(chan struct{}, 1),
+	}
+}
+
+// Triggered receives a value when a recollection has been requested since the
+// last call to Take.
+func (r *Receiver) Triggered() <-chan struct{} {
+	return r.triggered
+}
+
+// Request is what the deliveries since the last Take asked for. It is empty
+// when Triggered fired for deliveries an earlier Take already returned.
+type Request struct {
+	// Users are the affected logins, sorted.
+	Users []string
+	// All is set when every user should be recollected.
+	All bool
+	// Seats is set when seats were assigned or cancelled, so any seats listed
+	// before are out of date.
+	Seats bool
+}
+
+// Take returns and clears the pending request.
+func (r *Receiver) Take() Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	req := Request{All: r.all, Seats: r.seats}
+	for login := range r.users {
+		req.Users = append(req.Users, login)
+	}
+	slices.Sort(req.Users)
+	r.users = make(map[string]bool)
+	r.all, r.seats = false, false
+	return req
+}
+
+// Handle serves POST /webhooks/github.
+func (r *Receiver) Handle(c *fiber.Ctx) error {
+	body := c.Body()
+	if !r.verify(c.Get("X-Hub-Signature-256"), body) {
+		r.logger.Warn("rejected github webhook with invalid signature", zap.String("delivery", c.Get("X-GitHub-Delivery")))
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	event := c.Get("X-GitHub-Event")
+	if event == "ping" {
+		return c.SendStatus(fiber.StatusOK)
+	}
+	if !slices.Contains(r.events, event) {
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+
+	logins, err := affectedLogins(body)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("invalid payload")
+	}
+
+	r.mu.Lock()
+	if len(logins) == 0 {
+		r.all = true
+	}
+	if strings.HasPrefix(event, "copilot_seat_") {
+		r.seats = true
+	}
+	for _, login := range logins {
+		r.users[login] = true
+	}
+	r.mu.Unlock()
+
+	select {
+	case r.triggered <- struct{}{}:
+	default:
+	}
+
+	r.logger.Info("github webhook requested recollection",
+		zap.String("event", event),
+		zap.String("delivery", c.Get("X-GitHub-Delivery")),
+		zap.Strings("users", logins),
+	)
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// verify checks the sha256=<hex> HMAC GitHub computes over the body with the
+// shared secret.
+func (r *Receiver) verify(signature string, body []byte) bool {
+	hexSum, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(hexSum)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, r.secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+type account struct {
+	Login string `json:"login"`
+}
+
+type seat struct {
+	Assignee *account `json:"assignee"`
+}
+
+// affectedLogins extracts the seat holders a delivery refers to, from either
+// a single seat, a list of seats or a bare assignee.
+func affectedLogins(payload []byte) ([]string, error) {
+	var body struct {
+		Seat     *seat    `json:"seat"`
+		Seats    []seat   `json:"seats"`
+		Assignee *account `json:"assignee"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, err
+	}
+
+	var logins []string
+	add := func(a *account) {
+		if a != nil && a.Login != "" {
+			logins = append(logins, a.Login)
+		}
+	}
+	if body.Seat != nil {
+		add(body.Seat.Assignee)
+	}
+	for _, s := range body.Seats {
+		add(s.Assignee)
+	}
+	add(body.Assignee)
+	return logins, nil
+}
@@ -0,0 +1,173 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	const secret, body = "s3cret", `{"seat":{"assignee":{"login":"octocat"}}}`
+	tests := []struct {
+		name      string
+		signature string
+		body      string
+		want      bool
+	}{
+		{"valid", sign(secret, body), body, true},
+		{"uppercase hex", "sha256=" + strings.ToUpper(strings.TrimPrefix(sign(secret, body), "sha256=")), body, true},
+		{"wrong secret", sign("other", body), body, false},
+		{"tampered body", sign(secret, body), body + " ", false},
+		{"sha1 signature", "sha1=" + strings.TrimPrefix(sign(secret, body), "sha256="), body, false},
+		{"missing prefix", strings.TrimPrefix(sign(secret, body), "sha256="), body, false},
+		{"invalid hex", "sha256=zz", body, false},
+		{"truncated", sign(secret, body)[:20], body, false},
+		{"empty", "", body, false},
+	}
+	r := New(secret, nil, zap.NewNop())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.verify(tt.signature, []byte(tt.body)); got != tt.want {
+				t.Errorf("verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAffectedLogins(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    []string
+		wantErr bool
+	}{
+		{"single seat", `{"seat":{"assignee":{"login":"octocat"}}}`, []string{"octocat"}, false},
+		{"list of seats", `{"seats":[{"assignee":{"login":"a"}},{"assignee":{"login":"b"}}]}`, []string{"a", "b"}, false},
+		{"bare assignee", `{"assignee":{"login":"octocat"}}`, []string{"octocat"}, false},
+		{"seat without assignee", `{"seat":{}}`, nil, false},
+		{"empty login", `{"assignee":{"login":""}}`, nil, false},
+		{"billing event", `{"action":"updated","enterprise":{"slug":"acme"}}`, nil, false},
+		{"invalid json", `{"seat":`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := affectedLogins([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("affectedLogins() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("affectedLogins() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandle(t *testing.T) {
+	const secret = "s3cret"
+	type delivery struct {
+		event, body string
+		signed      bool
+	}
+	tests := []struct {
+		name       string
+		deliveries []delivery
+		wantStatus int
+		want       Request
+	}{
+		{
+			name:       "seat assignment",
+			deliveries: []delivery{{"copilot_seat_assignment", `{"seat":{"assignee":{"login":"b"}}}`, true}},
+			wantStatus: fiber.StatusAccepted,
+			want:       Request{Users: []string{"b"}, Seats: true},
+		},
+		{
+			name: "deliveries accumulate",
+			deliveries: []delivery{
+				{"copilot_seat_cancellation", `{"seat":{"assignee":{"login":"b"}}}`, true},
+				{"copilot_seat_assignment", `{"seats":[{"assignee":{"login":"a"}},{"assignee":{"login":"b"}}]}`, true},
+			},
+			wantStatus: fiber.StatusAccepted,
+			want:       Request{Users: []string{"a", "b"}, Seats: true},
+		},
+		{
+			name:       "billing event asks for everyone",
+			deliveries: []delivery{{"enterprise_billing", `{"action":"updated"}`, true}},
+			wantStatus: fiber.StatusAccepted,
+			want:       Request{All: true},
+		},
+		{
+			name:       "unsigned delivery is rejected",
+			deliveries: []delivery{{"copilot_seat_assignment", `{"seat":{"assignee":{"login":"b"}}}`, false}},
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "event not listened to",
+			deliveries: []delivery{{"push", `{"assignee":{"login":"b"}}`, true}},
+			wantStatus: fiber.StatusAccepted,
+		},
+		{
+			name:       "ping",
+			deliveries: []delivery{{"ping", `{"zen":"hi"}`, true}},
+			wantStatus: fiber.StatusOK,
+		},
+		{
+			name:       "invalid payload",
+			deliveries: []delivery{{"copilot_seat_assignment", `{"seat":`, true}},
+			wantStatus: fiber.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(secret, nil, zap.NewNop())
+			app := fiber.New()
+			app.Post("/webhooks/github", r.Handle)
+
+			var status int
+			for _, d := range tt.deliveries {
+				req := httptest.NewRequest("POST", "/webhooks/github", strings.NewReader(d.body))
+				req.Header.Set("X-GitHub-Event", d.event)
+				if d.signed {
+					req.Header.Set("X-Hub-Signature-256", sign(secret, d.body))
+				}
+				resp, err := app.Test(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				status = resp.StatusCode
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+
+			triggered := false
+			select {
+			case <-r.Triggered():
+				triggered = true
+			default:
+			}
+			if want := !reflect.DeepEqual(tt.want, Request{}); triggered != want {
+				t.Errorf("triggered = %v, want %v", triggered, want)
+			}
+			if got := r.Take(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Take() = %+v, want %+v", got, tt.want)
+			}
+			if got := r.Take(); !reflect.DeepEqual(got, Request{}) {
+				t.Errorf("second Take() = %+v, want an empty request", got)
+			}
+		})
+	}
+}